@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditEntry is one line of the audit log. Content is recorded only as a
+// hash so the log doesn't duplicate potentially sensitive memories.
+type auditEntry struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Op          string    `json:"op"`
+	ID          string    `json:"id"`
+	ContentHash string    `json:"content_sha256,omitempty"`
+}
+
+// auditLog appends mutations to a JSON lines file outside the database,
+// rotating it to path.1 once it would exceed maxBytes. A nil *auditLog
+// records nothing.
+type auditLog struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+}
+
+func newAuditLog(path string, maxBytes int64) *auditLog {
+	return &auditLog{path: path, maxBytes: maxBytes}
+}
+
+// Record appends an entry for a mutation and syncs it to disk. Deletes pass
+// empty content and are logged without a hash.
+func (a *auditLog) Record(op, id, content string) error {
+	if a == nil {
+		return nil
+	}
+
+	entry := auditEntry{
+		Timestamp: time.Now().UTC(),
+		Op:        op,
+		ID:        id,
+	}
+	if content != "" {
+		sum := sha256.Sum256([]byte(content))
+		entry.ContentHash = hex.EncodeToString(sum[:])
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.rotate(int64(len(line))); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return f.Sync()
+}
+
+// rotate moves the current log aside if appending n more bytes would exceed
+// the size limit, replacing any previous rotated file.
+func (a *auditLog) rotate(n int64) error {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if info.Size() == 0 || info.Size()+n <= a.maxBytes {
+		return nil
+	}
+	return os.Rename(a.path, a.path+".1")
+}
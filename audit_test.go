@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLogRotate(t *testing.T) {
+	tests := []struct {
+		name        string
+		exists      bool
+		existing    string
+		n           int64
+		wantRotated bool
+	}{
+		{name: "no log yet", n: 100},
+		{name: "empty log", exists: true, n: 100},
+		{name: "fits", exists: true, existing: "0123456789", n: 6},
+		{name: "exactly fills", exists: true, existing: "0123456789", n: 10},
+		{name: "overflows", exists: true, existing: "0123456789", n: 11, wantRotated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			if tt.exists {
+				if err := os.WriteFile(path, []byte(tt.existing), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(path+".1", []byte("older"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			a := newAuditLog(path, 20)
+			if err := a.rotate(tt.n); err != nil {
+				t.Fatal(err)
+			}
+
+			rotated, err := os.ReadFile(path + ".1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "older"
+			if tt.wantRotated {
+				want = tt.existing
+			}
+			if string(rotated) != want {
+				t.Errorf("rotated log holds %q, want %q", rotated, want)
+			}
+			if _, err := os.Stat(path); tt.exists && tt.wantRotated != os.IsNotExist(err) {
+				t.Errorf("current log after rotate: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuditLogRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a := newAuditLog(path, 200)
+
+	for _, id := range []string{"mem_1", "mem_2", "mem_3"} {
+		if err := a.Record("add", id, "content of "+id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Record("delete", "mem_1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []auditEntry
+	for _, p := range []string{path + ".1", path} {
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var entry auditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Fatalf("%s: %v", p, err)
+			}
+			entries = append(entries, entry)
+		}
+		f.Close()
+	}
+
+	// Each entry fills most of the limit, so every write rotates and only
+	// the last two survive.
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries across the log and its rotation, want 2", len(entries))
+	}
+	if entries[0].Op != "add" || entries[0].ID != "mem_3" {
+		t.Errorf("rotated entry = %+v, want the add of mem_3", entries[0])
+	}
+	last := entries[len(entries)-1]
+	if last.Op != "delete" || last.ID != "mem_1" || last.ContentHash != "" {
+		t.Errorf("last entry = %+v, want an unhashed delete of mem_1", last)
+	}
+	if len(entries[0].ContentHash) != 64 {
+		t.Errorf("add entry %+v has no content hash", entries[0])
+	}
+
+	var none *auditLog
+	if err := none.Record("add", "mem_1", "content"); err != nil {
+		t.Errorf("nil audit log: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+)
+
+const (
+	backupPrefix = "memory-"
+	backupSuffix = ".gob.gz"
+)
+
+// backupScheduler periodically exports the database to timestamped files in
+// dir, keeping only the most recent retain backups.
+type backupScheduler struct {
+	db *chromem.DB
+	// mu is held while copying the database, so no write lands half way
+	// through a snapshot.
+	mu       sync.Locker
+	dir      string
+	interval time.Duration
+	retain   int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startBackupScheduler(db *chromem.DB, mu sync.Locker, dir string, interval time.Duration, retain int) (*backupScheduler, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	b := &backupScheduler{
+		db:       db,
+		mu:       mu,
+		dir:      dir,
+		interval: interval,
+		retain:   retain,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+
+	return b, nil
+}
+
+func (b *backupScheduler) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			path, err := b.backup()
+			if err != nil {
+				log.Printf("Backup failed: %v", storageError(err))
+				continue
+			}
+			log.Printf("Backup written to %s", path)
+
+			if err := b.prune(); err != nil {
+				log.Printf("Failed to prune old backups: %v", err)
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// backup exports a snapshot of the whole database into a new timestamped
+// file. Only copying the database waits for writes; the slow export doesn't.
+func (b *backupScheduler) backup() (string, error) {
+	b.mu.Lock()
+	copied, err := snapshotDB(context.Background(), b.db)
+	b.mu.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("failed to copy database: %w", err)
+	}
+
+	name := backupPrefix + time.Now().UTC().Format("20060102T150405.000000000Z") + backupSuffix
+	path := filepath.Join(b.dir, name)
+
+	if err := copied.ExportToFile(path, true, ""); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to export database: %w", err)
+	}
+
+	return path, nil
+}
+
+// snapshotDB copies the named collections of db, or all of them, into a new
+// in-memory database. chromem-go exports a collection's live documents without
+// locking them, so exporting db directly would race with concurrent writes.
+func snapshotDB(ctx context.Context, db *chromem.DB, names ...string) (*chromem.DB, error) {
+	copied := chromem.NewDB()
+	for name, collection := range db.ListCollections() {
+		if len(names) > 0 && !slices.Contains(names, name) {
+			continue
+		}
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list collection %s: %w", name, err)
+		}
+		docs := make([]chromem.Document, 0, len(memories))
+		for _, memory := range memories {
+			docs = append(docs, chromem.Document{ID: memory.ID, Metadata: memory.Metadata, Embedding: memory.Embedding, Content: memory.Content})
+		}
+
+		target, err := copied.CreateCollection(name, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(docs) > 0 {
+			if err := target.AddDocuments(ctx, docs, 1); err != nil {
+				return nil, fmt.Errorf("failed to copy collection %s: %w", name, err)
+			}
+		}
+	}
+	return copied, nil
+}
+
+// prune removes all but the newest retain backups. Backup names sort
+// chronologically, so the oldest files come first.
+func (b *backupScheduler) prune() error {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	sort.Strings(backups)
+
+	for len(backups) > b.retain {
+		if err := os.Remove(filepath.Join(b.dir, backups[0])); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// Stop halts the scheduler and waits for an in-flight backup to finish.
+func (b *backupScheduler) Stop() {
+	close(b.stop)
+	<-b.done
+}
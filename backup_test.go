@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// testEmbedding returns a unit vector of the configured size pointing along
+// dimension i.
+func testEmbedding(i int) []float32 {
+	embedding := make([]float32, embeddingDimensions)
+	embedding[i%embeddingDimensions] = 1
+	return embedding
+}
+
+// testDocument returns a memory with a fixed embedding, so tests need no
+// embedding API.
+func testDocument(id, content string, metadata map[string]string) chromem.Document {
+	return chromem.Document{ID: id, Metadata: metadata, Embedding: testEmbedding(len(id)), Content: content}
+}
+
+func TestBackupDuringWrites(t *testing.T) {
+	ctx := context.Background()
+	db := chromem.NewDB()
+	collection, err := db.CreateCollection("memories", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	dir := t.TempDir()
+	scheduler, err := startBackupScheduler(db, &mu, dir, 10*time.Millisecond, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep adding and deleting a bounded set of memories, without the lock,
+	// while backups run
+	stop := make(chan struct{})
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			id := fmt.Sprintf("mem_%d", i%100)
+			if err := collection.AddDocument(ctx, testDocument(id, "memory "+id, nil)); err != nil {
+				t.Error(err)
+				return
+			}
+			if i%3 == 0 {
+				collection.Delete(ctx, nil, nil, id)
+			}
+		}
+	}()
+
+	var backups []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(backups) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		backups, _ = filepath.Glob(filepath.Join(dir, backupPrefix+"*"+backupSuffix))
+	}
+	close(stop)
+	<-written
+	scheduler.Stop()
+
+	backups, _ = filepath.Glob(filepath.Join(dir, backupPrefix+"*"+backupSuffix))
+	if len(backups) == 0 {
+		t.Fatal("no backup was written")
+	}
+	if len(backups) > 2 {
+		t.Errorf("%d backups kept, want at most 2", len(backups))
+	}
+
+	restored := chromem.NewDB()
+	if err := restored.ImportFromFile(backups[len(backups)-1], ""); err != nil {
+		t.Fatalf("backup doesn't import: %v", err)
+	}
+	if restored.GetCollection("memories", nil) == nil {
+		t.Error("backup is missing the memories collection")
+	}
+}
+
+func TestBackupPrune(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		backupPrefix + "20240101T000000.000000000Z" + backupSuffix,
+		backupPrefix + "20240102T000000.000000000Z" + backupSuffix,
+		backupPrefix + "20240103T000000.000000000Z" + backupSuffix,
+		"unrelated.txt",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := &backupScheduler{dir: dir, retain: 2}
+	if err := b.prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, entry := range entries {
+		left = append(left, entry.Name())
+	}
+	if got, want := strings.Join(left, " "), strings.Join(names[1:], " "); got != want {
+		t.Errorf("after pruning got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"container/list"
+	"slices"
+	"sync"
+	"time"
+)
+
+// searchCache is a size-bounded LRU cache of search results. Entries expire
+// after ttl, and Invalidate drops them all whenever the store changes. A nil
+// *searchCache caches nothing.
+type searchCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // of *searchCacheEntry, most recently used first
+	entries map[searchOptions]*list.Element
+	// generation counts invalidations, so a search that raced with a write
+	// isn't cached afterwards.
+	generation uint64
+}
+
+type searchCacheEntry struct {
+	key     searchOptions
+	result  searchResult
+	expires time.Time
+}
+
+func newSearchCache(size int, ttl time.Duration) *searchCache {
+	return &searchCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[searchOptions]*list.Element),
+	}
+}
+
+// Get returns a copy of the cached result for opts, along with the
+// generation to pass to Put when it misses.
+func (c *searchCache) Get(opts searchOptions) (searchResult, uint64, bool) {
+	if c == nil {
+		return searchResult{}, 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[opts]
+	if !ok {
+		return searchResult{}, c.generation, false
+	}
+	entry := element.Value.(*searchCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, entry.key)
+		return searchResult{}, c.generation, false
+	}
+
+	c.order.MoveToFront(element)
+	result := entry.result
+	result.Results = slices.Clone(result.Results)
+	return result, c.generation, true
+}
+
+// Put caches result for opts unless the cache was invalidated since the
+// generation returned by Get, evicting the least recently used entry when
+// full.
+func (c *searchCache) Put(opts searchOptions, generation uint64, result searchResult) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	result.Results = slices.Clone(result.Results)
+	entry := &searchCacheEntry{key: opts, result: result, expires: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[opts]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[opts] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*searchCacheEntry).key)
+	}
+}
+
+// Invalidate drops every cached result.
+func (c *searchCache) Invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.order.Init()
+	clear(c.entries)
+}
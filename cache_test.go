@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+)
+
+func TestSearchCache(t *testing.T) {
+	c := newSearchCache(2, time.Minute)
+	opts := searchOptions{Query: "cats", Limit: 5}
+	result := searchResult{Results: []chromem.Result{{ID: "mem_1"}, {ID: "mem_2"}}, Total: 2}
+
+	_, generation, ok := c.Get(opts)
+	if ok {
+		t.Fatal("empty cache hit")
+	}
+	c.Put(opts, generation, result)
+
+	got, _, ok := c.Get(opts)
+	if !ok || len(got.Results) != 2 || got.Results[0].ID != "mem_1" || got.Total != 2 {
+		t.Fatalf("Get = %+v, %v; want the cached result", got, ok)
+	}
+	// Hits are copies, so callers can't change the cached results
+	got.Results[0].ID = "changed"
+	if again, _, _ := c.Get(opts); again.Results[0].ID != "mem_1" {
+		t.Errorf("changing a hit changed the cache to %+v", again.Results)
+	}
+
+	// A write invalidates everything and moves the generation on, so a
+	// search that started before it isn't cached with stale results
+	_, before, _ := c.Get(searchOptions{Query: "dogs"})
+	c.Invalidate()
+	if _, _, ok := c.Get(opts); ok {
+		t.Error("hit after Invalidate")
+	}
+	c.Put(searchOptions{Query: "dogs"}, before, result)
+	if _, after, ok := c.Get(searchOptions{Query: "dogs"}); ok || after == before {
+		t.Errorf("result from generation %d cached after invalidation (now %d)", before, after)
+	}
+
+	// The least recently used entry goes once the cache is full
+	for _, query := range []string{"a", "b", "c"} {
+		_, generation, _ := c.Get(searchOptions{Query: query})
+		c.Put(searchOptions{Query: query}, generation, result)
+	}
+	if _, _, ok := c.Get(searchOptions{Query: "a"}); ok {
+		t.Error("oldest entry kept past the size limit")
+	}
+
+	var none *searchCache
+	none.Put(opts, 0, result)
+	if _, _, ok := none.Get(opts); ok {
+		t.Error("nil cache hit")
+	}
+}
+
+func TestSearchCacheExpiry(t *testing.T) {
+	c := newSearchCache(2, time.Millisecond)
+	opts := searchOptions{Query: "cats"}
+	_, generation, _ := c.Get(opts)
+	c.Put(opts, generation, searchResult{Total: 1})
+
+	time.Sleep(5 * time.Millisecond)
+	if _, _, ok := c.Get(opts); ok {
+		t.Error("hit after the TTL passed")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Change is a single mutation recorded in the change log.
+type Change struct {
+	Seq       uint64    `json:"seq"`
+	Op        string    `json:"op"`
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// changeLog is an append-only JSON lines file of mutations with monotonically
+// increasing sequence numbers, letting clients replicate the store.
+type changeLog struct {
+	mu   sync.Mutex
+	path string
+	seq  uint64
+}
+
+func openChangeLog(path string) (*changeLog, error) {
+	cl := &changeLog{path: path}
+	if err := cl.dropTornTail(); err != nil {
+		return nil, err
+	}
+
+	// Resume numbering after the last recorded change
+	changes, err := cl.read(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		cl.seq = changes[len(changes)-1].Seq
+	}
+
+	return cl, nil
+}
+
+// dropTornTail truncates an unterminated last line, left behind when the
+// process died part way through an append, so the log parses again and the
+// next entry starts on a line of its own.
+func (cl *changeLog) dropTornTail() error {
+	data, err := os.ReadFile(cl.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open change log: %w", err)
+	}
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return nil
+	}
+
+	log.Printf("Dropping an incomplete entry at the end of the change log %s", cl.path)
+	if err := os.Truncate(cl.path, int64(bytes.LastIndexByte(data, '\n')+1)); err != nil {
+		return fmt.Errorf("failed to repair change log: %w", err)
+	}
+	return nil
+}
+
+// Append records a mutation and syncs it to disk before returning.
+func (cl *changeLog) Append(op, id string) (Change, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	change := Change{
+		Seq:       cl.seq + 1,
+		Op:        op,
+		ID:        id,
+		Timestamp: time.Now().UTC(),
+	}
+
+	line, err := json.Marshal(change)
+	if err != nil {
+		return Change{}, err
+	}
+
+	f, err := os.OpenFile(cl.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return Change{}, fmt.Errorf("failed to open change log: %w", err)
+	}
+	defer f.Close()
+
+	// A failed write may still have landed part of the line, so cut the
+	// file back to where it was rather than leave an entry that won't parse.
+	info, err := f.Stat()
+	if err != nil {
+		return Change{}, fmt.Errorf("failed to open change log: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Truncate(info.Size())
+		return Change{}, fmt.Errorf("failed to write change log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Truncate(info.Size())
+		return Change{}, fmt.Errorf("failed to sync change log: %w", err)
+	}
+
+	cl.seq = change.Seq
+	return change, nil
+}
+
+// Since returns up to limit changes with a sequence number greater than seq,
+// in order. A limit of 0 returns all of them.
+func (cl *changeLog) Since(seq uint64, limit int) ([]Change, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	return cl.read(seq, limit)
+}
+
+// Prune removes delete entries (tombstones) recorded more than ttl ago,
+// rewriting the log atomically, and returns how many were removed. Other
+// entries are kept, as is the newest entry so numbering resumes correctly
+// after a restart. Replicas that haven't synced within ttl may miss deletes
+// and must resync from a full export.
+func (cl *changeLog) Prune(ttl time.Duration) (int, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	changes, err := cl.read(0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-ttl)
+	kept := changes[:0]
+	for _, change := range changes {
+		if change.Op == "delete" && change.Timestamp.Before(cutoff) && change.Seq != cl.seq {
+			continue
+		}
+		kept = append(kept, change)
+	}
+	pruned := len(changes) - len(kept)
+	if pruned == 0 {
+		return 0, nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(cl.path), filepath.Base(cl.path)+".tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to rewrite change log: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, change := range kept {
+		line, err := json.Marshal(change)
+		if err != nil {
+			return 0, err
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to rewrite change log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync change log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("failed to rewrite change log: %w", err)
+	}
+	if err := os.Rename(f.Name(), cl.path); err != nil {
+		return 0, fmt.Errorf("failed to replace change log: %w", err)
+	}
+
+	return pruned, nil
+}
+
+// sweepTombstones prunes expired tombstones now and then every interval
+// until stop is closed.
+func (cl *changeLog) sweepTombstones(ttl, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := cl.Prune(ttl)
+		if err != nil {
+			log.Printf("Failed to prune change log tombstones: %v", err)
+		} else if pruned > 0 {
+			log.Printf("Pruned %d change log tombstones older than %s", pruned, ttl)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (cl *changeLog) read(seq uint64, limit int) ([]Change, error) {
+	f, err := os.Open(cl.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open change log: %w", err)
+	}
+	defer f.Close()
+
+	var changes []Change
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var change Change
+		if err := json.Unmarshal(scanner.Bytes(), &change); err != nil {
+			return nil, fmt.Errorf("corrupt change log entry: %w", err)
+		}
+		if change.Seq <= seq {
+			continue
+		}
+		changes = append(changes, change)
+		if limit > 0 && len(changes) == limit {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read change log: %w", err)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestChangeLogPrune(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour).UTC()
+	recent := time.Now().Add(-time.Hour).UTC()
+	changes := []Change{
+		{Seq: 1, Op: "add", ID: "mem_1", Timestamp: old},
+		{Seq: 2, Op: "delete", ID: "mem_1", Timestamp: old},
+		{Seq: 3, Op: "add", ID: "mem_2", Timestamp: old},
+		{Seq: 4, Op: "delete", ID: "mem_2", Timestamp: recent},
+		{Seq: 5, Op: "delete", ID: "mem_3", Timestamp: old},
+	}
+
+	path := filepath.Join(t.TempDir(), "changes.jsonl")
+	var data []byte
+	for _, change := range changes {
+		line, err := json.Marshal(change)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cl, err := openChangeLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := cl.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 1 {
+		t.Errorf("pruned %d tombstones, want 1", pruned)
+	}
+
+	// The expired tombstone is gone, but the newest entry stays even though
+	// it's an expired tombstone too.
+	kept, err := cl.Since(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seqs []uint64
+	for _, change := range kept {
+		seqs = append(seqs, change.Seq)
+	}
+	if want := []uint64{1, 3, 4, 5}; !slices.Equal(seqs, want) {
+		t.Errorf("kept changes %v, want %v", seqs, want)
+	}
+
+	if pruned, err := cl.Prune(24 * time.Hour); err != nil || pruned != 0 {
+		t.Errorf("pruning again removed %d tombstones (%v), want 0", pruned, err)
+	}
+
+	reopened, err := openChangeLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := reopened.Append("add", "mem_4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Seq != 6 {
+		t.Errorf("numbering resumed at %d after pruning, want 6", change.Seq)
+	}
+
+	if matches, _ := filepath.Glob(path + ".tmp-*"); len(matches) > 0 {
+		t.Errorf("pruning left temporary files %v", matches)
+	}
+}
+
+func TestChangeLogTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.jsonl")
+	var data []byte
+	for i, id := range []string{"mem_1", "mem_2"} {
+		line, err := json.Marshal(Change{Seq: uint64(i + 1), Op: "add", ID: id, Timestamp: time.Now().UTC()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	// An append cut short by a crash
+	data = append(data, `{"seq":3,"op":"ad`...)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cl, err := openChangeLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := cl.Append("add", "mem_3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Seq != 3 {
+		t.Errorf("numbering resumed at %d, want 3", change.Seq)
+	}
+
+	changes, err := cl.Since(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, change := range changes {
+		ids = append(ids, change.ID)
+	}
+	if want := []string{"mem_1", "mem_2", "mem_3"}; !slices.Equal(ids, want) {
+		t.Errorf("changes after repair = %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+)
+
+const checkpointSuffix = ".gob.gz"
+
+// validCheckpointName keeps checkpoint names usable as file names.
+var validCheckpointName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// checkpoint is a named snapshot of the collection.
+type checkpoint struct {
+	Name      string
+	CreatedAt time.Time
+	Size      int64
+}
+
+// checkpointPath returns where the checkpoint called name is stored in dir.
+func checkpointPath(dir, name string) (string, error) {
+	if !validCheckpointName.MatchString(name) {
+		return "", fmt.Errorf("invalid checkpoint name %q: use up to 64 letters, digits, '.', '_' or '-'", name)
+	}
+	return filepath.Join(dir, name+checkpointSuffix), nil
+}
+
+// listCheckpoints returns the checkpoints in dir, newest first.
+func listCheckpoints(dir string) ([]checkpoint, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var checkpoints []checkpoint
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), checkpointSuffix)
+		if entry.IsDir() || !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, checkpoint{Name: name, CreatedAt: info.ModTime(), Size: info.Size()})
+	}
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i].CreatedAt.After(checkpoints[j].CreatedAt) })
+
+	return checkpoints, nil
+}
+
+// createCheckpoint writes a snapshot of the collection to path. The
+// collection is copied first, since exporting it directly would race with
+// concurrent writes.
+func createCheckpoint(ctx context.Context, db *chromem.DB, collectionName, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("checkpoint %s already exists", filepath.Base(path))
+	}
+
+	copied, err := snapshotDB(ctx, db, collectionName)
+	if err != nil {
+		return fmt.Errorf("failed to copy memories: %w", err)
+	}
+	if err := copied.ExportToFile(path, true, "", collectionName); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// loadCheckpoint reads the memories saved in the checkpoint at path. It goes
+// through a scratch in-memory database so the live one is untouched.
+func loadCheckpoint(ctx context.Context, collectionName, path string) ([]chromem.Result, error) {
+	scratch := chromem.NewDB()
+	if err := scratch.ImportFromFile(path, "", collectionName); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	collection := scratch.GetCollection(collectionName, nil)
+	if collection == nil {
+		return nil, nil
+	}
+	return listMemories(ctx, collection)
+}
+
+// checkpointDiff is what restoring a checkpoint changes.
+type checkpointDiff struct {
+	// Added are the IDs of memories added since the checkpoint, to delete.
+	Added []string
+	// Deleted are saved memories deleted since, to add back.
+	Deleted []chromem.Result
+	// Modified are saved memories changed since, to revert.
+	Modified []chromem.Result
+}
+
+// diffCheckpoint compares the memories saved in a checkpoint with the current
+// ones. Memories with the same content, embedding and metadata are left out,
+// so restoring doesn't rewrite them. Version and updated_at are ignored, since
+// restoring bumps them.
+func diffCheckpoint(saved, current []chromem.Result) checkpointDiff {
+	currentByID := make(map[string]chromem.Result, len(current))
+	for _, memory := range current {
+		currentByID[memory.ID] = memory
+	}
+
+	var diff checkpointDiff
+	for _, memory := range saved {
+		now, ok := currentByID[memory.ID]
+		switch {
+		case !ok:
+			diff.Deleted = append(diff.Deleted, memory)
+		case now.Content != memory.Content || !slices.Equal(now.Embedding, memory.Embedding) || !sameRestoredMetadata(now.Metadata, memory.Metadata):
+			diff.Modified = append(diff.Modified, memory)
+		}
+		delete(currentByID, memory.ID)
+	}
+	for id := range currentByID {
+		diff.Added = append(diff.Added, id)
+	}
+
+	sort.Strings(diff.Added)
+	byID := func(memories []chromem.Result) {
+		sort.Slice(memories, func(i, j int) bool { return memories[i].ID < memories[j].ID })
+	}
+	byID(diff.Deleted)
+	byID(diff.Modified)
+	return diff
+}
+
+// sameRestoredMetadata reports whether a and b match apart from the
+// bookkeeping that restoring a memory updates.
+func sameRestoredMetadata(a, b map[string]string) bool {
+	a, b = maps.Clone(a), maps.Clone(b)
+	for _, key := range []string{"version", "updated_at"} {
+		delete(a, key)
+		delete(b, key)
+	}
+	return maps.Equal(a, b)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/philippgille/chromem-go"
+)
+
+func TestCheckpointPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "before-cleanup"},
+		{name: "v1.2_final"},
+		{name: "", wantErr: true},
+		{name: "../escape", wantErr: true},
+		{name: ".hidden", wantErr: true},
+		{name: "has space", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		path, err := checkpointPath("/checkpoints", tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkpointPath(%q) error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && filepath.Dir(path) != "/checkpoints" {
+			t.Errorf("checkpointPath(%q) = %s, outside the checkpoint directory", tt.name, path)
+		}
+	}
+}
+
+func TestCheckpointRollback(t *testing.T) {
+	ctx := context.Background()
+	db := chromem.NewDB()
+	collection, err := db.CreateCollection("memories", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"mem_1", "mem_2", "mem_3"} {
+		if err := collection.AddDocument(ctx, testDocument(id, "content of "+id, map[string]string{"version": "1"})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, err := checkpointPath(t.TempDir(), "before-edit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := createCheckpoint(ctx, db, "memories", path); err != nil {
+		t.Fatal(err)
+	}
+	if err := createCheckpoint(ctx, db, "memories", path); err == nil {
+		t.Error("overwriting an existing checkpoint succeeded")
+	}
+
+	// Change one memory, delete one and add one
+	if err := collection.AddDocument(ctx, testDocument("mem_1", "edited", map[string]string{"version": "2"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := collection.Delete(ctx, nil, nil, "mem_2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := collection.AddDocument(ctx, testDocument("mem_4", "new", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := loadCheckpoint(ctx, "memories", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := listMemories(ctx, collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := diffCheckpoint(saved, current)
+	if !slices.Equal(diff.Added, []string{"mem_4"}) ||
+		!slices.Equal(resultIDs(diff.Deleted), []string{"mem_2"}) ||
+		!slices.Equal(resultIDs(diff.Modified), []string{"mem_1"}) {
+		t.Fatalf("diff added %v, deleted %v, modified %v; want mem_4, mem_2, mem_1 (mem_3 unchanged)",
+			diff.Added, resultIDs(diff.Deleted), resultIDs(diff.Modified))
+	}
+
+	// Applying the diff rolls the collection back
+	for _, id := range diff.Added {
+		collection.Delete(ctx, nil, nil, id)
+	}
+	for _, memory := range append(diff.Deleted, diff.Modified...) {
+		doc := chromem.Document{ID: memory.ID, Metadata: memory.Metadata, Embedding: memory.Embedding, Content: memory.Content}
+		if err := collection.AddDocument(ctx, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	current, err = listMemories(ctx, collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := diffCheckpoint(saved, current); len(diff.Added)+len(diff.Deleted)+len(diff.Modified) > 0 {
+		t.Errorf("after rollback the collection still differs: %+v", diff)
+	}
+	for _, memory := range current {
+		if memory.ID == "mem_1" && (memory.Content != "content of mem_1" || !maps.Equal(memory.Metadata, map[string]string{"version": "1"})) {
+			t.Errorf("mem_1 rolled back to %q %v", memory.Content, memory.Metadata)
+		}
+	}
+}
+
+func TestDiffCheckpointReembedded(t *testing.T) {
+	saved := []chromem.Result{
+		{ID: "mem_1", Content: "same", Embedding: []float32{1, 0}, Metadata: map[string]string{"version": "1"}},
+		{ID: "mem_2", Content: "same", Embedding: []float32{1, 0}, Metadata: map[string]string{"version": "1"}},
+	}
+	current := []chromem.Result{
+		// Re-embedded by another model
+		{ID: "mem_1", Content: "same", Embedding: []float32{0, 1}, Metadata: map[string]string{"version": "1"}},
+		// Restored before, which only moved its bookkeeping on
+		{ID: "mem_2", Content: "same", Embedding: []float32{1, 0}, Metadata: map[string]string{"version": "3", "updated_at": "2024-01-01T00:00:00Z"}},
+	}
+
+	diff := diffCheckpoint(saved, current)
+	if !slices.Equal(resultIDs(diff.Modified), []string{"mem_1"}) || len(diff.Added)+len(diff.Deleted) > 0 {
+		t.Errorf("diff added %v, deleted %v, modified %v; want only mem_1 modified",
+			diff.Added, resultIDs(diff.Deleted), resultIDs(diff.Modified))
+	}
+}
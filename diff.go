@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffCells bounds the size of the table diffTokens builds, the product of
+// the two token counts.
+const maxDiffCells = 4_000_000
+
+// diffOp is one token of a diff: kept in both, removed from the first text
+// or added in the second.
+type diffOp struct {
+	Kind  byte // ' ', '-' or '+'
+	Token string
+}
+
+// diffTokens computes a minimal edit script turning a into b from their
+// longest common subsequence.
+func diffTokens(a, b []string) ([]diffOp, error) {
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		return nil, fmt.Errorf("texts are too long to diff (%d and %d tokens)", len(a), len(b))
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops, nil
+}
+
+// formatLineDiff renders a line diff with a marker column, as in a unified
+// diff without hunk headers.
+func formatLineDiff(ops []diffOp) string {
+	var sb strings.Builder
+	for _, op := range ops {
+		sb.WriteByte(op.Kind)
+		sb.WriteString(op.Token)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// formatWordDiff renders a word diff inline, marking removed words as [-w-]
+// and added ones as {+w+}.
+func formatWordDiff(ops []diffOp) string {
+	words := make([]string, 0, len(ops))
+	for _, op := range ops {
+		switch op.Kind {
+		case '-':
+			words = append(words, "[-"+op.Token+"-]")
+		case '+':
+			words = append(words, "{+"+op.Token+"+}")
+		default:
+			words = append(words, op.Token)
+		}
+	}
+	return strings.Join(words, " ") + "\n"
+}
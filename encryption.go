@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// sealer encrypts the content of memories marked sensitive with AES-256-GCM.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+// newSealer creates a sealer from a base64-encoded 32-byte key.
+func newSealer(key string) (*sealer, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("key is not valid base64: %w", err)
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(raw))
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealer{aead: aead}, nil
+}
+
+// Seal encrypts plaintext under a random nonce, returning the nonce and
+// ciphertext base64 encoded together.
+func (s *sealer) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := s.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open reverses Seal, failing if the content was encrypted under a different
+// key or has been tampered with.
+func (s *sealer) Open(sealed string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", fmt.Errorf("sealed content is not valid base64: %w", err)
+	}
+	if len(raw) < s.aead.NonceSize() {
+		return "", errors.New("sealed content is truncated")
+	}
+
+	nonce, ciphertext := raw[:s.aead.NonceSize()], raw[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt content; was it sealed with a different key?")
+	}
+	return string(plaintext), nil
+}
+
+// sealedEmbedding is the placeholder embedding stored with encrypted
+// memories. They are kept out of similarity search, and embedding their
+// content would leak its meaning, so every one gets the same unit vector.
+func sealedEmbedding() []float32 {
+	embedding := make([]float32, embeddingDimensions)
+	embedding[0] = 1
+	return embedding
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// testKey returns a valid encryption key made of the byte b repeated.
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func TestSealer(t *testing.T) {
+	s, err := newSealer(testKey('a'))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := s.Seal("the secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "secret") {
+		t.Errorf("sealed content %q leaks the plaintext", sealed)
+	}
+	if again, _ := s.Seal("the secret"); again == sealed {
+		t.Error("sealing twice gave the same ciphertext; nonces must differ")
+	}
+	if opened, err := s.Open(sealed); err != nil || opened != "the secret" {
+		t.Errorf("Open = %q, %v; want the plaintext back", opened, err)
+	}
+
+	other, err := newSealer(testKey('b'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened, err := other.Open(sealed); err == nil {
+		t.Errorf("opening with the wrong key gave %q, want an error", opened)
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(sealed)
+	raw[len(raw)-1] ^= 1
+	if _, err := s.Open(base64.StdEncoding.EncodeToString(raw)); err == nil {
+		t.Error("opening tampered content succeeded")
+	}
+	if _, err := s.Open(base64.StdEncoding.EncodeToString(raw[:4])); err == nil {
+		t.Error("opening truncated content succeeded")
+	}
+
+	for _, key := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("too short"))} {
+		if _, err := newSealer(key); err == nil {
+			t.Errorf("newSealer(%q) accepted an invalid key", key)
+		}
+	}
+}
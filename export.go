@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// exportedMemory is the portable form of a memory used by export and import.
+// The embedding is included so imports don't need to call the embedding API.
+type exportedMemory struct {
+	ID        string            `json:"id"`
+	Content   string            `json:"content"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Embedding []float32         `json:"embedding,omitempty"`
+}
+
+// exportMemories converts query results into their portable form, oldest
+// first so exports are stable across calls.
+func exportMemories(results []chromem.Result) []exportedMemory {
+	memories := make([]exportedMemory, 0, len(results))
+	for _, result := range results {
+		memories = append(memories, exportedMemory{
+			ID:        result.ID,
+			Content:   result.Content,
+			Metadata:  result.Metadata,
+			Embedding: result.Embedding,
+		})
+	}
+
+	sort.Slice(memories, func(i, j int) bool {
+		ti, _ := memoryCreatedAt(memories[i].ID, memories[i].Metadata)
+		tj, _ := memoryCreatedAt(memories[j].ID, memories[j].Metadata)
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return memories[i].ID < memories[j].ID
+	})
+
+	return memories
+}
+
+// subgraphBundle is a memory and everything linked to it within some hops.
+// Links to memories outside the bundle are dropped so it is self-contained;
+// Edges lists the remaining links for consumers that don't read metadata.
+type subgraphBundle struct {
+	Root     string           `json:"root"`
+	Memories []exportedMemory `json:"memories"`
+	Edges    [][2]string      `json:"edges"`
+}
+
+// exportSubgraph bundles the nodes of a traversal, the first being the root.
+func exportSubgraph(nodes []graphNode) subgraphBundle {
+	included := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		included[node.Memory.ID] = true
+	}
+
+	bundle := subgraphBundle{Root: nodes[0].Memory.ID, Edges: [][2]string{}}
+	for _, node := range nodes {
+		memory := exportedMemory{
+			ID:        node.Memory.ID,
+			Content:   node.Memory.Content,
+			Metadata:  maps.Clone(node.Memory.Metadata),
+			Embedding: node.Memory.Embedding,
+		}
+
+		var links []string
+		for _, link := range memoryLinks(node.Memory.Metadata) {
+			if included[link] {
+				links = append(links, link)
+				bundle.Edges = append(bundle.Edges, [2]string{memory.ID, link})
+			}
+		}
+		if len(links) > 0 {
+			memory.Metadata["related"] = strings.Join(links, ",")
+		} else {
+			delete(memory.Metadata, "related")
+		}
+
+		bundle.Memories = append(bundle.Memories, memory)
+	}
+
+	return bundle
+}
+
+// encodeExport marshals memories, or a bundle of them, to JSON, optionally
+// gzipping and base64 encoding the result so it stays text-safe over stdio.
+// Compressed output is never indented since nobody reads it directly.
+func encodeExport(memories any, compressed, pretty bool) (string, error) {
+	data, err := marshalJSON(memories, pretty && !compressed)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode memories: %w", err)
+	}
+	if !compressed {
+		return string(data), nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return "", fmt.Errorf("failed to compress export: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress export: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decodeImport reverses encodeExport, accepting either a plain array of
+// memories or a subgraph bundle.
+func decodeImport(payload string, compressed bool) ([]exportedMemory, error) {
+	data := []byte(payload)
+	if compressed {
+		raw, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return nil, fmt.Errorf("compressed payload is not valid base64: %w", err)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("compressed payload is not valid gzip: %w", err)
+		}
+		defer zr.Close()
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("failed to decompress payload: %w", err)
+		}
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var bundle subgraphBundle
+		if err := json.Unmarshal(data, &bundle); err != nil {
+			return nil, fmt.Errorf("payload is not a valid subgraph bundle: %w", err)
+		}
+		return bundle.Memories, nil
+	}
+
+	var memories []exportedMemory
+	if err := json.Unmarshal(data, &memories); err != nil {
+		return nil, fmt.Errorf("payload is not a JSON array of memories: %w", err)
+	}
+
+	return memories, nil
+}
+
+// maxImportChunks bounds the number of memories an import_text call creates.
+const maxImportChunks = 1000
+
+// textSplitModes are the ways import_text can cut text into memories.
+var textSplitModes = []string{"line", "paragraph", "delimiter"}
+
+// blankLines separates paragraphs.
+var blankLines = regexp.MustCompile(`\n[ \t]*\n`)
+
+// splitText cuts text into chunks by line, by paragraph (runs of text
+// separated by blank lines) or at each occurrence of delimiter. Chunks are
+// trimmed and empty ones dropped.
+func splitText(text, mode, delimiter string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var parts []string
+	switch mode {
+	case "line":
+		parts = strings.Split(text, "\n")
+	case "delimiter":
+		parts = strings.Split(text, delimiter)
+	default:
+		parts = blankLines.Split(text, -1)
+	}
+
+	chunks := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			chunks = append(chunks, part)
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/philippgille/chromem-go"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		mode      string
+		delimiter string
+		want      []string
+	}{
+		{
+			name: "lines",
+			text: "buy milk\n\n  call Anna  \r\nwater plants\n",
+			mode: "line",
+			want: []string{"buy milk", "call Anna", "water plants"},
+		},
+		{
+			name: "paragraphs",
+			text: "First note\nstill the first.\n\nSecond note.\n \t\n\n\nThird note.",
+			mode: "paragraph",
+			want: []string{"First note\nstill the first.", "Second note.", "Third note."},
+		},
+		{
+			name: "windows paragraphs",
+			text: "one\r\n\r\ntwo",
+			mode: "paragraph",
+			want: []string{"one", "two"},
+		},
+		{
+			name:      "delimiter",
+			text:      "alpha\n---\nbeta\n---\n---\ngamma",
+			mode:      "delimiter",
+			delimiter: "---",
+			want:      []string{"alpha", "beta", "gamma"},
+		},
+		{
+			name: "blank",
+			text: " \n\n \n",
+			mode: "paragraph",
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := splitText(tt.text, tt.mode, tt.delimiter); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: splitText = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	memories := []exportedMemory{
+		{ID: "mem_1", Content: "first\nline two", Metadata: map[string]string{"raw_metadata": `{"type":"note"}`}, Embedding: []float32{0.6, 0.8}},
+		{ID: "mem_2", Content: "ünïcödé and \"quotes\""},
+	}
+
+	for _, compressed := range []bool{false, true} {
+		for _, pretty := range []bool{false, true} {
+			payload, err := encodeExport(memories, compressed, pretty)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decodeImport(payload, compressed)
+			if err != nil {
+				t.Fatalf("compressed %v, pretty %v: %v", compressed, pretty, err)
+			}
+			if !reflect.DeepEqual(got, memories) {
+				t.Errorf("compressed %v, pretty %v: round trip gave %+v, want %+v", compressed, pretty, got, memories)
+			}
+		}
+	}
+
+	if _, err := decodeImport("not base64!", true); err == nil {
+		t.Error("decoding invalid base64 succeeded")
+	}
+	if _, err := decodeImport(`{"memories": [`, false); err == nil {
+		t.Error("decoding a truncated bundle succeeded")
+	}
+}
+
+func TestExportSubgraphRoundTrip(t *testing.T) {
+	node := func(id, related string) graphNode {
+		metadata := map[string]string{"created_at": "2024-01-01T00:00:00Z"}
+		if related != "" {
+			metadata["related"] = related
+		}
+		return graphNode{Memory: chromem.Document{ID: id, Content: "content of " + id, Metadata: metadata}}
+	}
+	// mem_c links outside the traversal
+	nodes := []graphNode{node("mem_a", "mem_b"), node("mem_b", "mem_a,mem_c"), node("mem_c", "mem_z")}
+
+	bundle := exportSubgraph(nodes)
+	if bundle.Root != "mem_a" || len(bundle.Edges) != 3 {
+		t.Errorf("bundle root %s with edges %v, want mem_a with 3 edges", bundle.Root, bundle.Edges)
+	}
+
+	payload, err := encodeExport(bundle, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memories, err := decodeImport(payload, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(memories) != 3 {
+		t.Fatalf("imported %d memories, want 3", len(memories))
+	}
+	if related, ok := memories[2].Metadata["related"]; ok {
+		t.Errorf("link outside the bundle kept as related=%q", related)
+	}
+	if nodes[2].Memory.Metadata["related"] != "mem_z" {
+		t.Error("exportSubgraph modified the traversed memory")
+	}
+}
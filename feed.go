@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// feedFormats are the document formats the feed tool can produce.
+var feedFormats = []string{"json", "atom"}
+
+// feedPage is a page of memories to publish, newest first.
+type feedPage struct {
+	Title    string
+	Type     string
+	Limit    int
+	Memories []chromem.Result
+	// NextOffset is the offset of the following page, or 0 on the last.
+	NextOffset int
+}
+
+// feedURL is the address of the feed page at offset. It names the tool's
+// arguments so a client can follow paging links.
+func (p feedPage) feedURL(format string, offset int) string {
+	query := url.Values{"format": {format}}
+	if p.Type != "" {
+		query.Set("type", p.Type)
+	}
+	if p.Limit > 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	return "memory://feed?" + query.Encode()
+}
+
+// feedEntry holds the fields common to both formats for one memory.
+type feedEntry struct {
+	ID        string
+	Title     string
+	Content   string
+	Published time.Time
+	Updated   time.Time
+	Type      string
+}
+
+// entries converts the page's memories to feed entries, titled by their
+// first line.
+func (p feedPage) entries() []feedEntry {
+	entries := make([]feedEntry, 0, len(p.Memories))
+	for _, memory := range p.Memories {
+		published, _ := memoryCreatedAt(memory.ID, memory.Metadata)
+		entries = append(entries, feedEntry{
+			ID:        memory.ID,
+			Title:     memoryTitle(memory.Content, "first-line"),
+			Content:   memory.Content,
+			Published: published.UTC(),
+			Updated:   memoryLastActive(memory.ID, memory.Metadata).UTC(),
+			Type:      memoryType(memory.Metadata["raw_metadata"]),
+		})
+	}
+	return entries
+}
+
+// jsonFeed renders the page as a JSON Feed 1.1 document.
+func (p feedPage) jsonFeed(pretty bool) (string, error) {
+	type item struct {
+		ID            string    `json:"id"`
+		Title         string    `json:"title,omitempty"`
+		ContentText   string    `json:"content_text"`
+		DatePublished time.Time `json:"date_published"`
+		DateModified  time.Time `json:"date_modified"`
+		Tags          []string  `json:"tags,omitempty"`
+	}
+	type document struct {
+		Version string `json:"version"`
+		Title   string `json:"title"`
+		FeedURL string `json:"feed_url"`
+		NextURL string `json:"next_url,omitempty"`
+		Items   []item `json:"items"`
+	}
+
+	doc := document{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title:   p.Title,
+		FeedURL: p.feedURL("json", 0),
+		Items:   []item{},
+	}
+	if p.NextOffset > 0 {
+		doc.NextURL = p.feedURL("json", p.NextOffset)
+	}
+	for _, entry := range p.entries() {
+		it := item{
+			ID:            entry.ID,
+			Title:         entry.Title,
+			ContentText:   entry.Content,
+			DatePublished: entry.Published,
+			DateModified:  entry.Updated,
+		}
+		if entry.Type != "" {
+			it.Tags = []string{entry.Type}
+		}
+		doc.Items = append(doc.Items, it)
+	}
+
+	data, err := marshalJSON(doc, pretty)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// atomFeed renders the page as an Atom document, linking to the next page as
+// in RFC 5005.
+func (p feedPage) atomFeed() (string, error) {
+	type link struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	}
+	type category struct {
+		Term string `xml:"term,attr"`
+	}
+	type content struct {
+		Type string `xml:"type,attr"`
+		Text string `xml:",chardata"`
+	}
+	type entry struct {
+		ID        string     `xml:"id"`
+		Title     string     `xml:"title"`
+		Published string     `xml:"published"`
+		Updated   string     `xml:"updated"`
+		Category  []category `xml:"category"`
+		Content   content    `xml:"content"`
+	}
+	type feed struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"id"`
+		Title   string   `xml:"title"`
+		Updated string   `xml:"updated"`
+		Links   []link   `xml:"link"`
+		Entries []entry  `xml:"entry"`
+	}
+
+	doc := feed{
+		ID:    p.feedURL("atom", 0),
+		Title: p.Title,
+		Links: []link{{Rel: "self", Href: p.feedURL("atom", 0)}},
+	}
+	if p.NextOffset > 0 {
+		doc.Links = append(doc.Links, link{Rel: "next", Href: p.feedURL("atom", p.NextOffset)})
+	}
+
+	// A feed is as recent as its latest change; an empty one as of now
+	updated := time.Time{}
+	for _, e := range p.entries() {
+		atomEntry := entry{
+			ID:        "memory://" + e.ID,
+			Title:     e.Title,
+			Published: e.Published.Format(time.RFC3339),
+			Updated:   e.Updated.Format(time.RFC3339),
+			Content:   content{Type: "text", Text: e.Content},
+		}
+		if e.Type != "" {
+			atomEntry.Category = []category{{Term: e.Type}}
+		}
+		doc.Entries = append(doc.Entries, atomEntry)
+		if e.Updated.After(updated) {
+			updated = e.Updated
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now().UTC()
+	}
+	doc.Updated = updated.Format(time.RFC3339)
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode feed: %w", err)
+	}
+	return xml.Header + string(data), nil
+}
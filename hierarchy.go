@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// maxHierarchyDepth bounds ancestor walks, so a cycle introduced outside the
+// server can't loop forever.
+const maxHierarchyDepth = 100
+
+// childPolicies are what happens to the children of a deleted memory: they
+// move up to its parent, or are deleted along with it.
+var childPolicies = []string{"reparent", "cascade"}
+
+// memoryParent returns the ID of a memory's parent in the tree of memories,
+// which is separate from links, or "" for a root.
+func memoryParent(metadata map[string]string) string {
+	return metadata["parent"]
+}
+
+// memoryAncestors returns the ancestors of the memory id, nearest first.
+func memoryAncestors(ctx context.Context, collection *chromem.Collection, id string) ([]chromem.Document, error) {
+	doc, err := collection.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var ancestors []chromem.Document
+	for parentID := memoryParent(doc.Metadata); parentID != ""; parentID = memoryParent(doc.Metadata) {
+		if len(ancestors) == maxHierarchyDepth {
+			return nil, fmt.Errorf("%s is more than %d levels deep; its ancestry may contain a cycle", id, maxHierarchyDepth)
+		}
+		if doc, err = collection.GetByID(ctx, parentID); err != nil {
+			return nil, fmt.Errorf("ancestor %s not found: %w", parentID, err)
+		}
+		ancestors = append(ancestors, doc)
+	}
+	return ancestors, nil
+}
+
+// checkParent verifies that parentID exists and that making it the parent
+// of id wouldn't create a cycle. An empty parentID is always valid.
+func checkParent(ctx context.Context, collection *chromem.Collection, id, parentID string) error {
+	if parentID == "" {
+		return nil
+	}
+	if parentID == id {
+		return fmt.Errorf("%s can't be its own parent", id)
+	}
+
+	ancestors, err := memoryAncestors(ctx, collection, parentID)
+	if err != nil {
+		return fmt.Errorf("parent memory not found: %w", err)
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.ID == id {
+			return fmt.Errorf("%s is a descendant of %s; moving it there would create a cycle", parentID, id)
+		}
+	}
+	return nil
+}
+
+// memoryChildren returns the direct children of id among memories, oldest
+// first.
+func memoryChildren(memories []chromem.Result, id string) []chromem.Result {
+	var children []chromem.Result
+	for _, memory := range memories {
+		if memoryParent(memory.Metadata) == id {
+			children = append(children, memory)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		a, _ := memoryCreatedAt(children[i].ID, children[i].Metadata)
+		b, _ := memoryCreatedAt(children[j].ID, children[j].Metadata)
+		return a.Before(b)
+	})
+	return children
+}
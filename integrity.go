@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// integrityReport is the result of a read-only consistency check of the
+// store. Counts are of memories, except BrokenLinks which counts links.
+type integrityReport struct {
+	TotalMemories int `json:"total_memories"`
+	// ListedMemories is how many memories a full scan returned; it differs
+	// from TotalMemories if some can't be read back.
+	ListedMemories      int    `json:"listed_memories"`
+	ListError           string `json:"list_error,omitempty"`
+	BadEmbeddings       int    `json:"bad_embeddings"`
+	EmptyContent        int    `json:"empty_content"`
+	UnparseableMetadata int    `json:"unparseable_metadata"`
+	BrokenLinks         int    `json:"broken_links"`
+	SchemaCurrent       bool   `json:"schema_current"`
+	SchemaError         string `json:"schema_error,omitempty"`
+	ChangeLogError      string `json:"change_log_error,omitempty"`
+	Healthy             bool   `json:"healthy"`
+}
+
+// checkIntegrity inspects every stored memory, the schema marker at
+// schemaPath against want and the change log without modifying anything.
+func checkIntegrity(ctx context.Context, collection *chromem.Collection, schemaPath string, want storeSchema, changes *changeLog) integrityReport {
+	report := integrityReport{TotalMemories: collection.Count()}
+
+	if schema, err := readSchema(schemaPath); err != nil {
+		report.SchemaError = err.Error()
+	} else {
+		report.SchemaCurrent = schema == want
+	}
+
+	if _, err := changes.Since(0, 0); err != nil {
+		report.ChangeLogError = err.Error()
+	}
+
+	memories, err := listMemories(ctx, collection)
+	if err != nil {
+		report.ListError = err.Error()
+	}
+	report.ListedMemories = len(memories)
+
+	ids := make(map[string]bool, len(memories))
+	for _, memory := range memories {
+		ids[memory.ID] = true
+	}
+
+	for _, memory := range memories {
+		if !validEmbedding(memory.Embedding) {
+			report.BadEmbeddings++
+		}
+		if memory.Content == "" {
+			report.EmptyContent++
+		}
+		if !validMetadata(memory.Metadata) {
+			report.UnparseableMetadata++
+		}
+		for _, link := range memoryLinks(memory.Metadata) {
+			if !ids[link] {
+				report.BrokenLinks++
+			}
+		}
+	}
+
+	report.Healthy = report.ListError == "" &&
+		report.ListedMemories == report.TotalMemories &&
+		report.BadEmbeddings == 0 &&
+		report.EmptyContent == 0 &&
+		report.UnparseableMetadata == 0 &&
+		report.BrokenLinks == 0 &&
+		report.SchemaCurrent &&
+		report.ChangeLogError == ""
+	return report
+}
+
+// validEmbedding reports whether an embedding has the expected dimensions
+// and only finite, not all zero, values.
+func validEmbedding(embedding []float32) bool {
+	if len(embedding) != embeddingDimensions {
+		return false
+	}
+
+	nonZero := false
+	for _, v := range embedding {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return false
+		}
+		if v != 0 {
+			nonZero = true
+		}
+	}
+	return nonZero
+}
+
+// validMetadata reports whether the metadata fields the server manages can
+// be parsed. The user's raw metadata is free-form and isn't checked.
+func validMetadata(metadata map[string]string) bool {
+	for _, key := range []string{"created_at", "updated_at"} {
+		if v, ok := metadata[key]; ok {
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				return false
+			}
+		}
+	}
+	if v, ok := metadata["version"]; ok {
+		if version, err := strconv.Atoi(v); err != nil || version < 1 {
+			return false
+		}
+	}
+	if v, ok := metadata["importance"]; ok {
+		importance, err := strconv.Atoi(v)
+		if err != nil || importance < minImportance || importance > maxImportance {
+			return false
+		}
+	}
+	return true
+}
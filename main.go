@@ -2,10 +2,27 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"maps"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -13,175 +30,4574 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
+// embeddingModel produces the vectors for stored memories and queries, and
+// embeddingDimensions is the size of those vectors. Other providers set them
+// with MEMORY_EMBED_MODEL and MEMORY_EMBED_DIMENSIONS at startup.
+var (
+	embeddingModel      = openai.AdaEmbeddingV2
+	embeddingDimensions = 1536
+)
+
+// Importance ranges from 1 (trivial) to 5 (critical). Memories stored before
+// importance existed count as the default.
+const (
+	minImportance     = 1
+	maxImportance     = 5
+	defaultImportance = 3
+)
+
 type MemoryServer struct {
 	db       *chromem.DB
+	dbPath   string
 	aiClient *openai.Client
+	// embedURL is the OpenAI-compatible embeddings endpoint in use, empty
+	// for OpenAI itself.
+	embedURL string
+	// embedMetadata makes stored embeddings cover metadata values too.
+	embedMetadata bool
+	// querySynonyms are the synonyms searches can expand query words with.
+	querySynonyms querySynonyms
+}
+
+func NewMemoryServer(dbPath string, openAIKey string, embedURL string) (*MemoryServer, error) {
+	// Create or open the database
+	db, err := chromem.NewPersistentDB(dbPath, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create/open database: %w", err)
+	}
+
+	// An existing directory opens fine even when read-only, and writes would
+	// only fail later on the first add, so probe it up front.
+	if err := checkWritable(dbPath); err != nil {
+		return nil, err
+	}
+
+	// Create OpenAI client for embeddings, optionally pointed at another
+	// provider with an OpenAI-compatible API
+	config := openai.DefaultConfig(openAIKey)
+	if embedURL != "" {
+		config.BaseURL = embedURL
+	}
+	client := openai.NewClientWithConfig(config)
+
+	return &MemoryServer{
+		db:       db,
+		dbPath:   dbPath,
+		aiClient: client,
+		embedURL: embedURL,
+	}, nil
+}
+
+// embedMemory generates the stored embedding of a memory: its content, plus
+// its metadata values when embedMetadata is set.
+func (ms *MemoryServer) embedMemory(ctx context.Context, content, rawMetadata string) ([]float32, error) {
+	return ms.generateEmbedding(ctx, embeddingText(content, rawMetadata, ms.embedMetadata))
+}
+
+// embeddingText appends the values of JSON object metadata, ordered by key,
+// to content so that searches match words that only appear in metadata.
+// Metadata that isn't a JSON object is appended as is.
+func embeddingText(content, rawMetadata string, includeMetadata bool) string {
+	if !includeMetadata || strings.TrimSpace(rawMetadata) == "" {
+		return content
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(rawMetadata), &fields); err != nil || fields == nil {
+		return content + "\n\n" + rawMetadata
+	}
+
+	keys := slices.Sorted(maps.Keys(fields))
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		switch v := fields[key].(type) {
+		case string:
+			values = append(values, v)
+		case nil:
+		default:
+			data, _ := json.Marshal(v)
+			values = append(values, string(data))
+		}
+	}
+	return content + "\n\n" + strings.Join(values, " ")
+}
+
+// checkWritable verifies that new files can be created in dir.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			return fmt.Errorf("database path %q is not writable by this process (permission denied); "+
+				"fix its ownership/permissions or point MEMORY_DB_PATH at a writable volume: %w", dir, err)
+		}
+		return fmt.Errorf("database path %q is not writable; if it is on a read-only filesystem, "+
+			"point MEMORY_DB_PATH at a writable volume: %w", dir, err)
+	}
+
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+func (ms *MemoryServer) generateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	queryReq := openai.EmbeddingRequest{
+		Input: []string{text},
+		Model: embeddingModel,
+	}
+
+	queryResponse, err := ms.aiClient.CreateEmbeddings(ctx, queryReq)
+	if err != nil {
+		return nil, fmt.Errorf("error creating embedding: %w", err)
+	}
+	if len(queryResponse.Data) == 0 {
+		return nil, errors.New("error creating embedding: the provider returned no embedding")
+	}
+
+	// Stored vectors, listing and search all assume one size
+	embedding := queryResponse.Data[0].Embedding
+	if len(embedding) != embeddingDimensions {
+		return nil, fmt.Errorf("error creating embedding: the provider returned %d dimensions, not the %d of MEMORY_EMBED_DIMENSIONS", len(embedding), embeddingDimensions)
+	}
+
+	// Convert float64 to float32
+	result := make([]float32, len(embedding))
+	for i, v := range embedding {
+		result[i] = float32(v)
+	}
+
+	return result, nil
+}
+
+// listMemories returns every document in the collection. chromem-go has no
+// listing API, so this runs an exhaustive query with a fixed probe vector.
+func listMemories(ctx context.Context, collection *chromem.Collection) ([]chromem.Result, error) {
+	probe := make([]float32, embeddingDimensions)
+	probe[0] = 1
+
+	// The query fails if memories are deleted between counting and
+	// querying, so count again and retry
+	for {
+		count := collection.Count()
+		if count == 0 {
+			return nil, nil
+		}
+
+		results, err := collection.QueryEmbedding(ctx, probe, count, nil, nil)
+		if err != nil && collection.Count() < count {
+			continue
+		}
+		return results, err
+	}
+}
+
+// memoryCreatedAt returns when a memory was stored. Older memories have no
+// created_at metadata, so it falls back to the nanosecond timestamp in the ID.
+func memoryCreatedAt(id string, metadata map[string]string) (time.Time, bool) {
+	if v, ok := metadata["created_at"]; ok {
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, true
+		}
+	}
+
+	nanos, err := strconv.ParseInt(strings.TrimPrefix(id, "mem_"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// memoryImportance returns a memory's importance, or the default if unset.
+func memoryImportance(metadata map[string]string) int {
+	importance, err := strconv.Atoi(metadata["importance"])
+	if err != nil {
+		return defaultImportance
+	}
+	return importance
+}
+
+// memoryLinks returns the IDs of the memories linked to a memory.
+func memoryLinks(metadata map[string]string) []string {
+	if metadata["related"] == "" {
+		return nil
+	}
+	return strings.Split(metadata["related"], ",")
+}
+
+// withLink returns a copy of doc that is also linked to id.
+func withLink(doc chromem.Document, id string) chromem.Document {
+	links := memoryLinks(doc.Metadata)
+	if !slices.Contains(links, id) {
+		links = append(links, id)
+	}
+
+	doc.Metadata = maps.Clone(doc.Metadata)
+	doc.Metadata["related"] = strings.Join(links, ",")
+	return doc
+}
+
+// maxGraphDepth bounds link traversal so dense graphs can't explode.
+const maxGraphDepth = 5
+
+// graphNode is a memory reached while traversing links, with its distance
+// in hops from the starting memory.
+type graphNode struct {
+	Memory chromem.Document
+	Depth  int
+}
+
+// relatedGraph does a breadth-first traversal of links from id, up to depth
+// hops away. Each memory is visited once, so cycles terminate. Links to
+// memories that no longer exist are skipped. The starting memory is first.
+func relatedGraph(ctx context.Context, collection *chromem.Collection, id string, depth int) ([]graphNode, error) {
+	start, err := collection.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []graphNode{{Memory: start}}
+	visited := map[string]bool{id: true}
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[i]
+		if node.Depth >= depth {
+			continue
+		}
+		for _, link := range memoryLinks(node.Memory.Metadata) {
+			if visited[link] {
+				continue
+			}
+			visited[link] = true
+
+			related, err := collection.GetByID(ctx, link)
+			if err != nil {
+				continue
+			}
+			nodes = append(nodes, graphNode{Memory: related, Depth: node.Depth + 1})
+		}
+	}
+
+	return nodes, nil
+}
+
+// memoryLastActive returns when a memory was last updated or touched,
+// falling back to its creation time.
+func memoryLastActive(id string, metadata map[string]string) time.Time {
+	if t, err := time.Parse(time.RFC3339Nano, metadata["updated_at"]); err == nil {
+		return t
+	}
+	createdAt, _ := memoryCreatedAt(id, metadata)
+	return createdAt
+}
+
+// reviewAfter is how long a memory may go untouched before it needs review.
+// The allowance scales with importance, so a trivial memory comes up for
+// review well before a critical one.
+func reviewAfter(staleAfter time.Duration, importance int) time.Duration {
+	return staleAfter * time.Duration(importance) / defaultImportance
+}
+
+// dayRange returns the span [start, end) of the day date, written as
+// YYYY-MM-DD, in loc. Days around daylight saving changes aren't 24 hours
+// long.
+func dayRange(date string, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("date must be in YYYY-MM-DD format")
+	}
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+// activityGranularities are the period lengths activity_timeline buckets by.
+var activityGranularities = []string{"day", "week", "month"}
+
+// maxActivityPeriods bounds the length of an activity series.
+const maxActivityPeriods = 1000
+
+// periodStart returns the start of the day, ISO week (Monday) or month
+// containing t, in t's location.
+func periodStart(t time.Time, granularity string) time.Time {
+	y, m, d := t.Date()
+	switch granularity {
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, t.Location())
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// nextPeriod returns the start of the period after the one starting at start.
+func nextPeriod(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// memorySize approximates the storage a memory takes, excluding its
+// fixed-size embedding.
+func memorySize(content string, metadata map[string]string) int64 {
+	size := int64(len(content))
+	for k, v := range metadata {
+		size += int64(len(k) + len(v))
+	}
+	return size
+}
+
+// Bucket upper bounds for the histograms in memory://stats. Values above the
+// last bound fall into a final unbounded bucket.
+var (
+	contentLengthBuckets = []int{64, 256, 1024, 4096, 16384}
+	linkCountBuckets     = []int{0, 1, 2, 5, 10}
+)
+
+// histogramBucket counts the values up to and including Max, and above the
+// previous bucket's Max. The last bucket has no Max.
+type histogramBucket struct {
+	Max   *int `json:"max"`
+	Count int  `json:"count"`
+}
+
+// histogram counts values into buckets bounded by the sorted bounds.
+type histogram struct {
+	bounds []int
+	counts []int
+}
+
+func newHistogram(bounds []int) *histogram {
+	return &histogram{bounds: bounds, counts: make([]int, len(bounds)+1)}
+}
+
+func (h *histogram) Observe(v int) {
+	h.counts[sort.SearchInts(h.bounds, v)]++
 }
 
-func NewMemoryServer(dbPath string, openAIKey string) (*MemoryServer, error) {
-	// Create or open the database
-	db, err := chromem.NewPersistentDB(dbPath, true)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create/open database: %w", err)
-	}
+func (h *histogram) Buckets() []histogramBucket {
+	buckets := make([]histogramBucket, len(h.counts))
+	for i, count := range h.counts {
+		buckets[i].Count = count
+		if i < len(h.bounds) {
+			buckets[i].Max = &h.bounds[i]
+		}
+	}
+	return buckets
+}
+
+// evictionCandidates picks the least recently active memories to delete so
+// that the store fits within maxRecords and maxBytes (zero means no limit).
+// Memories of maximum importance are pinned and never evicted.
+func evictionCandidates(memories []chromem.Result, maxRecords int, maxBytes int64) []string {
+	var total int64
+	for _, memory := range memories {
+		total += memorySize(memory.Content, memory.Metadata)
+	}
+
+	sort.Slice(memories, func(i, j int) bool {
+		return memoryLastActive(memories[i].ID, memories[i].Metadata).Before(memoryLastActive(memories[j].ID, memories[j].Metadata))
+	})
+
+	var evict []string
+	count := len(memories)
+	for _, memory := range memories {
+		overRecords := maxRecords > 0 && count > maxRecords
+		overBytes := maxBytes > 0 && total > maxBytes
+		if !overRecords && !overBytes {
+			break
+		}
+		if memoryImportance(memory.Metadata) == maxImportance {
+			continue
+		}
+
+		evict = append(evict, memory.ID)
+		count--
+		total -= memorySize(memory.Content, memory.Metadata)
+	}
+
+	return evict
+}
+
+// errDiskFull marks writes that failed because the volume holding the
+// database ran out of space.
+var errDiskFull = errors.New("disk full")
+
+// storageError turns out-of-space failures into an actionable errDiskFull.
+func storageError(err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("%w: free space on the volume holding MEMORY_DB_PATH and retry (%v)", errDiskFull, err)
+	}
+	return err
+}
+
+// putDocument stores doc in collection. chromem-go updates its in-memory
+// copy before writing the file, so if the write fails the previous state is
+// put back to keep searches from seeing a memory that isn't on disk.
+func putDocument(ctx context.Context, collection *chromem.Collection, doc chromem.Document) error {
+	previous, getErr := collection.GetByID(ctx, doc.ID)
+	if err := collection.AddDocument(ctx, doc); err != nil {
+		if getErr == nil {
+			collection.AddDocument(ctx, previous)
+		} else {
+			collection.Delete(ctx, nil, nil, doc.ID)
+		}
+		return storageError(err)
+	}
+	return nil
+}
+
+// changeRecorder records a mutation of a memory. Deletes pass empty content.
+type changeRecorder func(op, id, content string) error
+
+// errVersionConflict is returned when a memory changed between being read
+// and being updated.
+var errVersionConflict = errors.New("version conflict")
+
+// memoryVersion returns how many times a memory has been updated, counting
+// from 1 for a new memory.
+func memoryVersion(metadata map[string]string) int {
+	version, err := strconv.Atoi(metadata["version"])
+	if err != nil {
+		return 1
+	}
+	return version
+}
+
+// checkExpectedVersion rejects an update whose optional expectedVersion
+// argument doesn't match the memory's current version.
+func checkExpectedVersion(arguments map[string]any, doc chromem.Document) error {
+	expected, ok := arguments["expectedVersion"].(float64)
+	if !ok || int(expected) == memoryVersion(doc.Metadata) {
+		return nil
+	}
+	return fmt.Errorf("%w: memory %s is at version %d, not %d; re-read it and retry", errVersionConflict, doc.ID, memoryVersion(doc.Metadata), int(expected))
+}
+
+// updateMu serializes the version check and write in saveUpdate.
+var updateMu sync.Mutex
+
+// saveUpdate persists a modified copy of a memory and records the change,
+// restoring the previous version if the change can't be recorded. It fails
+// with errVersionConflict if the memory changed since previous was read, so
+// concurrent read-modify-write updates can't silently overwrite each other.
+func saveUpdate(ctx context.Context, collection *chromem.Collection, record changeRecorder, previous, updated chromem.Document) error {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	if current, err := collection.GetByID(ctx, previous.ID); err == nil && memoryVersion(current.Metadata) != memoryVersion(previous.Metadata) {
+		return fmt.Errorf("%w: memory %s was changed concurrently; re-read it and retry", errVersionConflict, previous.ID)
+	}
+
+	updated.Metadata = maps.Clone(updated.Metadata)
+	updated.Metadata["updated_at"] = time.Now().UTC().Format(time.RFC3339Nano)
+	updated.Metadata["version"] = strconv.Itoa(memoryVersion(previous.Metadata) + 1)
+
+	if err := putDocument(ctx, collection, updated); err != nil {
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+
+	if err := record("update", updated.ID, updated.Content); err != nil {
+		collection.AddDocument(ctx, previous)
+		return fmt.Errorf("failed to record change: %w", err)
+	}
+
+	return nil
+}
+
+// cosineSimilarity assumes both vectors are normalized, which chromem-go
+// guarantees for stored embeddings.
+func cosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
+
+// nearDuplicateClusters groups memories whose embeddings are at least
+// threshold similar. Only memories of the same type are compared, which
+// keeps the pairwise comparison from spanning the whole store.
+func nearDuplicateClusters(memories []chromem.Result, threshold float32) [][]chromem.Result {
+	byType := make(map[string][]int)
+	for i, memory := range memories {
+		t := memoryType(memory.Metadata["raw_metadata"])
+		byType[t] = append(byType[t], i)
+	}
+
+	// Union-find over memory indexes
+	parent := make([]int, len(memories))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for _, group := range byType {
+		for x := 0; x < len(group); x++ {
+			for y := x + 1; y < len(group); y++ {
+				i, j := group[x], group[y]
+				if cosineSimilarity(memories[i].Embedding, memories[j].Embedding) >= threshold {
+					parent[find(i)] = find(j)
+				}
+			}
+		}
+	}
+
+	members := make(map[int][]chromem.Result)
+	for i, memory := range memories {
+		root := find(i)
+		members[root] = append(members[root], memory)
+	}
+
+	var clusters [][]chromem.Result
+	for _, cluster := range members {
+		if len(cluster) < 2 {
+			continue
+		}
+		sort.Slice(cluster, func(i, j int) bool { return cluster[i].ID < cluster[j].ID })
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i][0].ID < clusters[j][0].ID })
+
+	return clusters
+}
+
+// tokenize splits text into lowercase words, dropping punctuation.
+func tokenize(text string) []string {
+	return splitWords(strings.ToLower(text))
+}
+
+// splitWords splits text into words as written, dropping punctuation.
+func splitWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// suggestCompletions finds phrases in contents that complete partial: the
+// completed words must match in sequence and the last, partial word must be
+// a prefix of the next token. Each completion extends one word past the
+// completed prefix, so "mach" can suggest "machine learning". Suggestions
+// are ranked by how often they occur.
+func suggestCompletions(contents []string, partial string, limit int) []string {
+	words := tokenize(partial)
+	if len(words) == 0 {
+		return nil
+	}
+	complete, prefix := words[:len(words)-1], words[len(words)-1]
+	if strings.HasSuffix(partial, " ") {
+		complete, prefix = words, ""
+	}
+
+	counts := make(map[string]int)
+	for _, content := range contents {
+		tokens := tokenize(content)
+	positions:
+		for i := 0; i+len(complete) < len(tokens); i++ {
+			for j, word := range complete {
+				if tokens[i+j] != word {
+					continue positions
+				}
+			}
+
+			next := i + len(complete)
+			if !strings.HasPrefix(tokens[next], prefix) {
+				continue
+			}
+
+			end := min(next+2, len(tokens))
+			counts[strings.Join(tokens[i:end], " ")]++
+		}
+	}
+
+	suggestions := make([]string, 0, len(counts))
+	for suggestion := range counts {
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if counts[suggestions[i]] != counts[suggestions[j]] {
+			return counts[suggestions[i]] > counts[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// matchedTerms counts how many distinct terms of query appear as words in
+// content, ignoring case unless caseSensitive is set.
+func matchedTerms(query, content string, caseSensitive bool) int {
+	split := tokenize
+	if caseSensitive {
+		split = splitWords
+	}
+
+	words := make(map[string]bool)
+	for _, word := range split(content) {
+		words[word] = true
+	}
+
+	matched := 0
+	seen := make(map[string]bool)
+	for _, term := range split(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		if words[term] {
+			matched++
+		}
+	}
+	return matched
+}
+
+// checkUTF8 rejects text containing invalid UTF-8, or replaces the invalid
+// bytes with U+FFFD when replace is set.
+func checkUTF8(field, text string, replace bool) (string, error) {
+	if utf8.ValidString(text) {
+		return text, nil
+	}
+	if !replace {
+		return "", fmt.Errorf("%s contains invalid UTF-8", field)
+	}
+	return strings.ToValidUTF8(text, "\uFFFD"), nil
+}
+
+// normalizeContent trims surrounding whitespace and, when collapse is set,
+// replaces each internal run of whitespace with a single space.
+func normalizeContent(content string, collapse bool) string {
+	if collapse {
+		return strings.Join(strings.Fields(content), " ")
+	}
+	return strings.TrimSpace(content)
+}
+
+// contentHash identifies content regardless of case and whitespace, so that
+// trivially different copies of the same text hash equally.
+func contentHash(content string) [sha256.Size]byte {
+	normalized := strings.ToLower(strings.Join(strings.Fields(content), " "))
+	return sha256.Sum256([]byte(normalized))
+}
+
+// dedupeResults keeps the first result for each distinct content hash and
+// reports how many duplicates were dropped. Query results are ordered by
+// similarity, so the highest-scoring copy is the one kept.
+func dedupeResults(results []chromem.Result) ([]chromem.Result, int) {
+	seen := make(map[[sha256.Size]byte]bool, len(results))
+	deduped := results[:0:0]
+	for _, result := range results {
+		hash := contentHash(result.Content)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		deduped = append(deduped, result)
+	}
+	return deduped, len(results) - len(deduped)
+}
+
+// memoryType returns the "type" field of a memory's JSON metadata, or an
+// empty string if the metadata is not a JSON object or has no type.
+func memoryType(rawMetadata string) string {
+	var fields struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(rawMetadata), &fields); err != nil {
+		return ""
+	}
+	return fields.Type
+}
+
+// withType returns rawMetadata with its "type" field set to t, keeping the
+// other fields. Empty metadata is treated as an empty object.
+func withType(rawMetadata, t string) (string, error) {
+	fields := make(map[string]any)
+	if strings.TrimSpace(rawMetadata) != "" {
+		if err := json.Unmarshal([]byte(rawMetadata), &fields); err != nil || fields == nil {
+			return "", errors.New("metadata is not a JSON object")
+		}
+	}
+	fields["type"] = t
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// applyDefaultType fills in defaultType when JSON object metadata has no
+// "type" field. A type that is present but not a non-empty string is an
+// error, so a client's mistake isn't silently relabelled. Metadata that isn't
+// a JSON object is left as is.
+func applyDefaultType(rawMetadata, defaultType string) (string, error) {
+	fields := make(map[string]any)
+	if strings.TrimSpace(rawMetadata) != "" {
+		if err := json.Unmarshal([]byte(rawMetadata), &fields); err != nil || fields == nil {
+			return rawMetadata, nil
+		}
+	}
+
+	if t, present := fields["type"]; present {
+		if s, ok := t.(string); !ok || strings.TrimSpace(s) == "" {
+			return "", errors.New("metadata type must be a non-empty string; omit it to use the default type")
+		}
+		return rawMetadata, nil
+	}
+	if defaultType == "" {
+		return rawMetadata, nil
+	}
+	return withType(rawMetadata, defaultType)
+}
+
+// typeCounts returns how many stored memories use each type.
+func typeCounts(ctx context.Context, collection *chromem.Collection) (map[string]int, error) {
+	memories, err := listMemories(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, memory := range memories {
+		if t := memoryType(memory.Metadata["raw_metadata"]); t != "" {
+			counts[t]++
+		}
+	}
+	return counts, nil
+}
+
+// closestType returns the candidate with the smallest edit distance to t.
+func closestType(t string, candidates []string) string {
+	best, bestDistance := "", -1
+	for _, candidate := range candidates {
+		d := levenshtein(t, candidate)
+		if bestDistance < 0 || d < bestDistance || (d == bestDistance && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// levenshtein computes the edit distance between two strings.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// titleModes are the ways text output can shorten multi-line memories to a
+// title. An empty mode shows the full content.
+var titleModes = []string{"first-line", "first-sentence"}
+
+// memoryTitle shortens content to its first non-empty line or its first
+// sentence, which also ends at a line break, marking it with an ellipsis
+// when anything was cut.
+func memoryTitle(content, mode string) string {
+	if mode == "" {
+		return content
+	}
+
+	rest := strings.TrimSpace(content)
+	title := rest
+	if i := strings.IndexByte(rest, '\n'); i >= 0 {
+		title = strings.TrimSpace(rest[:i])
+	}
+	if mode == "first-sentence" {
+		for i, r := range title {
+			if (r == '.' || r == '!' || r == '?') && (i+1 == len(title) || title[i+1] == ' ' || title[i+1] == '\t') {
+				title = title[:i+1]
+				break
+			}
+		}
+	}
+
+	if title != rest {
+		title += " …"
+	}
+	return title
+}
+
+// timestampLayouts are names for common time layouts MEMORY_TIME_FORMAT may
+// use instead of spelling out a Go layout.
+var timestampLayouts = map[string]string{
+	"rfc3339":  time.RFC3339,
+	"rfc1123":  time.RFC1123,
+	"datetime": time.DateTime,
+	"stamp":    time.Stamp,
+	"kitchen":  time.Kitchen,
+}
+
+// timestampFormat renders timestamps in text-mode output. JSON output always
+// uses RFC 3339.
+type timestampFormat struct {
+	Layout   string
+	Location *time.Location
+}
+
+// parseTimestampFormat resolves a layout name or Go layout for loc. An empty
+// layout means RFC 3339.
+func parseTimestampFormat(layout string, loc *time.Location) (timestampFormat, error) {
+	if layout == "" {
+		layout = time.RFC3339
+	} else if named, ok := timestampLayouts[strings.ToLower(layout)]; ok {
+		layout = named
+	} else if time.Unix(0, 0).Format(layout) == layout {
+		// A layout without any reference-time element formats as itself
+		return timestampFormat{}, fmt.Errorf("%q contains no Go time layout elements, such as 2006-01-02 15:04", layout)
+	}
+	return timestampFormat{Layout: layout, Location: loc}, nil
+}
+
+// Format renders t in the format's location and layout.
+func (f timestampFormat) Format(t time.Time) string {
+	return t.In(f.Location).Format(f.Layout)
+}
+
+// memoryView is the data available to MEMORY_RESULT_TEMPLATE for each memory
+// in text-mode output.
+type memoryView struct {
+	Index     int
+	ID        string
+	Content   string
+	Title     string
+	Type      string
+	Metadata  string
+	CreatedAt time.Time
+	// Created is CreatedAt formatted per MEMORY_TIME_FORMAT and
+	// MEMORY_TIMEZONE.
+	Created string
+	// UpdatedAt is when the memory last changed, or CreatedAt if it never
+	// did, and Updated is it formatted like Created.
+	UpdatedAt  time.Time
+	Updated    string
+	Similarity float32
+}
+
+func newMemoryView(index int, result chromem.Result, titleMode string, timestamps timestampFormat) memoryView {
+	createdAt, _ := memoryCreatedAt(result.ID, result.Metadata)
+	updatedAt := memoryLastActive(result.ID, result.Metadata)
+	return memoryView{
+		Index:      index,
+		ID:         result.ID,
+		Content:    result.Content,
+		Title:      memoryTitle(result.Content, titleMode),
+		Type:       memoryType(result.Metadata["raw_metadata"]),
+		Metadata:   result.Metadata["raw_metadata"],
+		CreatedAt:  createdAt,
+		Created:    timestamps.Format(createdAt),
+		UpdatedAt:  updatedAt,
+		Updated:    timestamps.Format(updatedAt),
+		Similarity: result.Similarity,
+	}
+}
+
+// projectionFields are the memory fields that can be selected with the
+// fields argument.
+var projectionFields = []string{"id", "content", "metadata", "type", "importance", "created_at", "updated_at", "version", "similarity"}
+
+// projectMemory returns only the requested fields of a memory, for JSON
+// output.
+func projectMemory(result chromem.Result, fields []string) map[string]any {
+	projected := make(map[string]any, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "id":
+			projected[field] = result.ID
+		case "content":
+			projected[field] = result.Content
+		case "metadata":
+			projected[field] = result.Metadata["raw_metadata"]
+		case "type":
+			projected[field] = memoryType(result.Metadata["raw_metadata"])
+		case "importance":
+			projected[field] = memoryImportance(result.Metadata)
+		case "created_at":
+			if createdAt, ok := memoryCreatedAt(result.ID, result.Metadata); ok {
+				projected[field] = createdAt.UTC()
+			}
+		case "updated_at":
+			if updatedAt, ok := result.Metadata["updated_at"]; ok {
+				projected[field] = updatedAt
+			}
+		case "version":
+			projected[field] = memoryVersion(result.Metadata)
+		case "similarity":
+			projected[field] = result.Similarity
+		}
+	}
+	return projected
+}
+
+// parseFields reads the optional fields argument, rejecting unknown names.
+func parseFields(arguments map[string]any) ([]string, error) {
+	raw, ok := arguments["fields"].([]any)
+	if !ok {
+		return nil, nil
+	}
+
+	fields := make([]string, 0, len(raw))
+	for _, r := range raw {
+		field, ok := r.(string)
+		if !ok || !slices.Contains(projectionFields, field) {
+			return nil, fmt.Errorf("invalid field %v; valid fields are %s", r, strings.Join(projectionFields, ", "))
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// fitResponse renders the largest prefix of n items whose output fits within
+// maxBytes, returning the output and how many items it holds. render(k) must
+// grow with k. A maxBytes of 0 means no limit.
+func fitResponse(n, maxBytes int, render func(k int) (string, error)) (string, int, error) {
+	out, err := render(n)
+	if err != nil || maxBytes <= 0 || len(out) <= maxBytes {
+		return out, n, err
+	}
+
+	// Binary search for the largest k that fits; zero items always "fit"
+	lo, hi := 0, n-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		out, err := render(mid)
+		if err != nil {
+			return "", 0, err
+		}
+		if len(out) <= maxBytes {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	out, err = render(lo)
+	return out, lo, err
+}
+
+// fitEntries joins header and as many entries as fit within maxBytes,
+// saying how many were left out.
+func fitEntries(header string, entries []string, maxBytes int) string {
+	out, _, _ := fitResponse(len(entries), maxBytes, func(k int) (string, error) {
+		out := header + strings.Join(entries[:k], "")
+		if k < len(entries) {
+			out += fmt.Sprintf("Only %d of %d entries fit in the %d byte response limit.\n", k, len(entries), maxBytes)
+		}
+		return out, nil
+	})
+	return out
+}
+
+// marshalJSON encodes tool output, indented for humans when pretty is set.
+func marshalJSON(v any, pretty bool) ([]byte, error) {
+	if pretty {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+// renderMemory executes the result template for a single memory.
+func renderMemory(tmpl *template.Template, view memoryView) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, view); err != nil {
+		return "", fmt.Errorf("failed to render result template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// rejectUnknownArguments wraps handler so calls passing argument keys the
+// tool's schema doesn't declare fail, naming the unexpected keys, instead of
+// the keys being silently ignored.
+func rejectUnknownArguments(tool mcp.Tool, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var unknown []string
+		for key := range request.Params.Arguments {
+			if _, ok := tool.InputSchema.Properties[key]; !ok {
+				unknown = append(unknown, key)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return mcp.NewToolResultError(fmt.Sprintf("unexpected arguments for %s: %s", tool.Name, strings.Join(unknown, ", "))), nil
+		}
+		return handler(ctx, request)
+	}
+}
+
+func main() {
+	// Get environment variables
+	dbPath := os.Getenv("MEMORY_DB_PATH")
+	if dbPath == "" {
+		dbPath = "./memory"
+	}
+
+	// Embeddings come from OpenAI unless another OpenAI-compatible endpoint
+	// is configured, which may not need a key
+	embedURL := strings.TrimSuffix(os.Getenv("MEMORY_EMBED_URL"), "/")
+	openAIKey := os.Getenv("OPENAI_API_KEY")
+	if openAIKey == "" && embedURL == "" {
+		log.Fatal("OPENAI_API_KEY environment variable required")
+	}
+
+	// Such a provider usually serves a different model, with its own vector
+	// size
+	if model := os.Getenv("MEMORY_EMBED_MODEL"); model != "" {
+		embeddingModel = openai.EmbeddingModel(model)
+	}
+	if v := os.Getenv("MEMORY_EMBED_DIMENSIONS"); v != "" {
+		dimensions, err := strconv.Atoi(v)
+		if err != nil || dimensions < 1 {
+			log.Fatalf("Invalid MEMORY_EMBED_DIMENSIONS %q: must be a positive integer", v)
+		}
+		embeddingDimensions = dimensions
+	}
+
+	// Create memory server
+	memServer, err := NewMemoryServer(dbPath, openAIKey, embedURL)
+	if err != nil {
+		log.Fatalf("Failed to create memory server: %v", err)
+	}
+
+	s, stop := newMCPServer(memServer)
+	defer stop()
+
+	// Start the server
+	if err := server.ServeStdio(s); err != nil {
+		fmt.Printf("Server error: %v\n", err)
+	}
+}
+
+// newMCPServer registers the tools and resources serving memServer, configured
+// from the environment, and starts the background work they rely on. stop
+// ends that work.
+func newMCPServer(memServer *MemoryServer) (s *server.MCPServer, stop func()) {
+	dbPath := memServer.dbPath
+	var stops []func()
+	stop = func() {
+		for _, stop := range slices.Backward(stops) {
+			stop()
+		}
+	}
+
+	collectionName := os.Getenv("MEMORY_COLLECTION")
+	if collectionName == "" {
+		collectionName = "memories"
+	}
+
+	// Timezone used to decide which day a memory belongs to
+	timezone := os.Getenv("MEMORY_TIMEZONE")
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	defaultLocation, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.Fatalf("Invalid MEMORY_TIMEZONE %q: %v", timezone, err)
+	}
+
+	// Timestamps in text output are shown in MEMORY_TIMEZONE using
+	// MEMORY_TIME_FORMAT, a layout name or Go layout
+	timestamps, err := parseTimestampFormat(os.Getenv("MEMORY_TIME_FORMAT"), defaultLocation)
+	if err != nil {
+		log.Fatalf("Invalid MEMORY_TIME_FORMAT: %v", err)
+	}
+
+	// Invalid UTF-8 is rejected unless configured to be replaced
+	replaceInvalidUTF8 := false
+	switch policy := os.Getenv("MEMORY_INVALID_UTF8"); policy {
+	case "", "reject":
+	case "replace":
+		replaceInvalidUTF8 = true
+	default:
+		log.Fatalf("Invalid MEMORY_INVALID_UTF8 %q: must be reject or replace", policy)
+	}
+
+	// JSON tool output is compact unless configured otherwise; each call can
+	// still override this with its pretty argument
+	prettyJSON := os.Getenv("MEMORY_PRETTY_JSON") == "true"
+	wantPretty := func(arguments map[string]any) bool {
+		if pretty, ok := arguments["pretty"].(bool); ok {
+			return pretty
+		}
+		return prettyJSON
+	}
+
+	// Collapsing internal whitespace loses formatting, so it is opt-in
+	collapseWhitespace := os.Getenv("MEMORY_COLLAPSE_WHITESPACE") == "true"
+
+	// Largest number of memories a single export may return
+	exportMax := 10000
+	if maximum := os.Getenv("MEMORY_EXPORT_MAX"); maximum != "" {
+		exportMax, err = strconv.Atoi(maximum)
+		if err != nil || exportMax < 1 {
+			log.Fatalf("Invalid MEMORY_EXPORT_MAX %q: must be a positive integer", maximum)
+		}
+	}
+
+	// Named checkpoints of the collection live next to the database
+	checkpointDir := os.Getenv("MEMORY_CHECKPOINT_DIR")
+	if checkpointDir == "" {
+		checkpointDir = dbPath + "_checkpoints"
+	}
+
+	// Optional cap on the size of list-like tool responses, for clients that
+	// reject large messages
+	var maxResponseBytes int
+	if v := os.Getenv("MEMORY_MAX_RESPONSE_BYTES"); v != "" {
+		maxResponseBytes, err = strconv.Atoi(v)
+		if err != nil || maxResponseBytes < 1 {
+			log.Fatalf("Invalid MEMORY_MAX_RESPONSE_BYTES %q: must be a positive integer", v)
+		}
+	}
+
+	// Optional bounds on store size, enforced by evicting old memories
+	var maxRecords int
+	if v := os.Getenv("MEMORY_MAX_RECORDS"); v != "" {
+		maxRecords, err = strconv.Atoi(v)
+		if err != nil || maxRecords < 1 {
+			log.Fatalf("Invalid MEMORY_MAX_RECORDS %q: must be a positive integer", v)
+		}
+	}
+	var maxBytes int64
+	if v := os.Getenv("MEMORY_MAX_BYTES"); v != "" {
+		maxBytes, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || maxBytes < 1 {
+			log.Fatalf("Invalid MEMORY_MAX_BYTES %q: must be a positive integer", v)
+		}
+	}
+
+	// Order of search matches when a call doesn't specify one
+	var defaultSort sortSpec
+	if spec := os.Getenv("MEMORY_DEFAULT_SORT"); spec != "" {
+		defaultSort, err = parseSortSpec(spec)
+		if err != nil {
+			log.Fatalf("Invalid MEMORY_DEFAULT_SORT %q: %v", spec, err)
+		}
+	}
+
+	// Upper bound on how long a single search may run
+	searchTimeout := 10 * time.Second
+	if timeout := os.Getenv("MEMORY_SEARCH_TIMEOUT"); timeout != "" {
+		searchTimeout, err = time.ParseDuration(timeout)
+		if err != nil || searchTimeout <= 0 {
+			log.Fatalf("Invalid MEMORY_SEARCH_TIMEOUT %q: must be a positive duration such as 10s", timeout)
+		}
+	}
+
+	// Optionally answer search_memory with a keyword scan while the
+	// embedding API is unavailable
+	searchFallback := os.Getenv("MEMORY_SEARCH_FALLBACK") == "true"
+
+	// Optionally cache search results briefly; any write clears the cache
+	var cache *searchCache
+	if v := os.Getenv("MEMORY_SEARCH_CACHE_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 {
+			log.Fatalf("Invalid MEMORY_SEARCH_CACHE_SIZE %q: must be a non-negative integer", v)
+		}
+		ttl := 30 * time.Second
+		if v := os.Getenv("MEMORY_SEARCH_CACHE_TTL"); v != "" {
+			ttl, err = time.ParseDuration(v)
+			if err != nil || ttl <= 0 {
+				log.Fatalf("Invalid MEMORY_SEARCH_CACHE_TTL %q: must be a positive duration", v)
+			}
+		}
+		if size > 0 {
+			cache = newSearchCache(size, ttl)
+		}
+	}
+
+	// What happens to the children of a deleted memory
+	childPolicy := "reparent"
+	if policy := os.Getenv("MEMORY_CHILD_POLICY"); policy != "" {
+		if !slices.Contains(childPolicies, policy) {
+			log.Fatalf("Invalid MEMORY_CHILD_POLICY %q: must be one of %s", policy, strings.Join(childPolicies, ", "))
+		}
+		childPolicy = policy
+	}
+
+	// Strict type mode rejects memory types that are neither known up front
+	// nor already used in the store
+	strictTypes := os.Getenv("MEMORY_STRICT_TYPES") == "true"
+	knownTypes := []string{"fact"}
+	if types := os.Getenv("MEMORY_KNOWN_TYPES"); types != "" {
+		knownTypes = nil
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				knownTypes = append(knownTypes, t)
+			}
+		}
+	}
+
+	// Type given to memories whose metadata doesn't name one; in strict mode
+	// it is always an allowed type
+	defaultType := strings.TrimSpace(os.Getenv("MEMORY_DEFAULT_TYPE"))
+	if defaultType != "" && !slices.Contains(knownTypes, defaultType) {
+		knownTypes = append(knownTypes, defaultType)
+	}
+
+	// Synonymous types are stored under their preferred name and match it in
+	// type filters
+	synonyms, err := loadTypeSynonyms(os.Getenv("MEMORY_TYPE_SYNONYMS"))
+	if err != nil {
+		log.Fatalf("Invalid MEMORY_TYPE_SYNONYMS: %v", err)
+	}
+
+	// Optionally shorten memories to a title in search and date listings;
+	// the full content stays available through get_memories and JSON output
+	titleMode := os.Getenv("MEMORY_TITLE_MODE")
+	if titleMode != "" && !slices.Contains(titleModes, titleMode) {
+		log.Fatalf("Invalid MEMORY_TITLE_MODE %q: must be one of %s", titleMode, strings.Join(titleModes, ", "))
+	}
+
+	// Optional template for rendering each memory in text output; validate it
+	// against a sample memory so mistakes surface at startup
+	var resultTemplate *template.Template
+	if text := os.Getenv("MEMORY_RESULT_TEMPLATE"); text != "" {
+		resultTemplate, err = template.New("result").Option("missingkey=error").Parse(text)
+		if err != nil {
+			log.Fatalf("Invalid MEMORY_RESULT_TEMPLATE: %v", err)
+		}
+		if _, err := renderMemory(resultTemplate, memoryView{Index: 1, ID: "mem_0", CreatedAt: time.Now(), Created: timestamps.Format(time.Now()), UpdatedAt: time.Now(), Updated: timestamps.Format(time.Now())}); err != nil {
+			log.Fatalf("Invalid MEMORY_RESULT_TEMPLATE: %v", err)
+		}
+	}
+
+	// Optionally embed metadata values with the content so similarity search
+	// also matches them; toggling this re-embeds the store
+	memServer.embedMetadata = os.Getenv("MEMORY_EMBED_METADATA") == "true"
+	memServer.querySynonyms, err = loadQuerySynonyms(os.Getenv("MEMORY_QUERY_SYNONYMS"))
+	if err != nil {
+		log.Fatalf("Invalid MEMORY_QUERY_SYNONYMS: %v", err)
+	}
+
+	// Open the change log used for incremental sync
+	changes, err := openChangeLog(filepath.Join(dbPath, collectionName+".changelog.jsonl"))
+	if err != nil {
+		log.Fatalf("Failed to open change log: %v", err)
+	}
+
+	// Optionally expire delete entries from the change log; replicas offline
+	// for longer than the TTL have to resync from a full export
+	if ttl := os.Getenv("MEMORY_TOMBSTONE_TTL"); ttl != "" {
+		tombstoneTTL, err := time.ParseDuration(ttl)
+		if err != nil || tombstoneTTL <= 0 {
+			log.Fatalf("Invalid MEMORY_TOMBSTONE_TTL %q: must be a positive duration such as 720h", ttl)
+		}
+
+		stopSweep := make(chan struct{})
+		stops = append(stops, func() { close(stopSweep) })
+		go changes.sweepTombstones(tombstoneTTL, min(tombstoneTTL, time.Hour), stopSweep)
+	}
+
+	// Optionally replace secrets such as API keys in memory content before it
+	// is stored or embedded
+	var contentRedactor *redactor
+	if os.Getenv("MEMORY_REDACT") == "true" {
+		contentRedactor, err = newRedactor(os.Getenv("MEMORY_REDACT_PATTERNS"))
+		if err != nil {
+			log.Fatalf("Invalid MEMORY_REDACT_PATTERNS: %v", err)
+		}
+	}
+	redact := func(id, content string) string {
+		content, n := contentRedactor.Redact(content)
+		if n > 0 {
+			log.Printf("Redacted %d secrets from the content of %s", n, id)
+		}
+		return content
+	}
+
+	// Optionally keep an audit trail of mutations outside the database
+	var audit *auditLog
+	if path := os.Getenv("MEMORY_AUDIT_LOG"); path != "" {
+		auditMaxBytes := int64(10 << 20)
+		if v := os.Getenv("MEMORY_AUDIT_LOG_MAX_BYTES"); v != "" {
+			auditMaxBytes, err = strconv.ParseInt(v, 10, 64)
+			if err != nil || auditMaxBytes < 1 {
+				log.Fatalf("Invalid MEMORY_AUDIT_LOG_MAX_BYTES %q: must be a positive integer", v)
+			}
+		}
+		audit = newAuditLog(path, auditMaxBytes)
+	}
+
+	// recordChange logs a mutation to the change log and, when enabled, the
+	// audit log. Only change log failures abort the mutation, since replicas
+	// depend on it.
+	recordChange := func(op, id, content string) error {
+		cache.Invalidate()
+		if _, err := changes.Append(op, id); err != nil {
+			return storageError(err)
+		}
+		if err := audit.Record(op, id, content); err != nil {
+			log.Printf("Failed to write audit log entry for %s %s: %v", op, id, storageError(err))
+		}
+		return nil
+	}
+
+	// Tool calls share storeMu while they run and don't exclude each other:
+	// chromem-go locks each document, saveUpdate's version check catches
+	// conflicting updates and reads retry when memories vanish under them.
+	// Only whole-store work in the background, the backup copy and the
+	// retention sweep, takes it exclusively, so it never sees a tool's
+	// multi-document change half applied.
+	var storeMu sync.RWMutex
+
+	// Schedule periodic backups when an interval is configured
+	if interval := os.Getenv("MEMORY_BACKUP_INTERVAL"); interval != "" {
+		backupInterval, err := time.ParseDuration(interval)
+		if err != nil || backupInterval <= 0 {
+			log.Fatalf("Invalid MEMORY_BACKUP_INTERVAL %q: must be a positive duration such as 6h", interval)
+		}
+
+		backupDir := os.Getenv("MEMORY_BACKUP_DIR")
+		if backupDir == "" {
+			backupDir = dbPath + "_backups"
+		}
+
+		backupRetain := 7
+		if retain := os.Getenv("MEMORY_BACKUP_RETAIN"); retain != "" {
+			backupRetain, err = strconv.Atoi(retain)
+			if err != nil || backupRetain < 1 {
+				log.Fatalf("Invalid MEMORY_BACKUP_RETAIN %q: must be a positive integer", retain)
+			}
+		}
+
+		scheduler, err := startBackupScheduler(memServer.db, &storeMu, backupDir, backupInterval, backupRetain)
+		if err != nil {
+			log.Fatalf("Failed to start backup scheduler: %v", err)
+		}
+		stops = append(stops, scheduler.Stop)
+	}
+
+	// Create MCP server
+	s = server.NewMCPServer(
+		"ChromeDB Memory Server",
+		"1.0.0",
+		server.WithResourceCapabilities(true, true),
+		server.WithLogging(),
+	)
+
+	// In strict mode tools reject argument keys missing from their schema,
+	// which catches misspelled arguments; by default they are ignored
+	strictArguments := os.Getenv("MEMORY_STRICT_ARGS") == "true"
+	addTool := func(tool mcp.Tool, handler server.ToolHandlerFunc) {
+		if strictArguments {
+			handler = rejectUnknownArguments(tool, handler)
+		}
+		s.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			storeMu.RLock()
+			defer storeMu.RUnlock()
+			return handler(ctx, request)
+		})
+	}
+
+	// Get or create collection
+	collection, err := memServer.db.GetOrCreateCollection(collectionName, nil, nil)
+	if err != nil {
+		log.Fatalf("Failed to get/create collection: %v", err)
+	}
+
+	// Memories marked sensitive are stored encrypted in a separate collection
+	// that similarity search never looks at
+	var contentSealer *sealer
+	var sealedCollection *chromem.Collection
+	if key := os.Getenv("MEMORY_ENCRYPTION_KEY"); key != "" {
+		contentSealer, err = newSealer(key)
+		if err != nil {
+			log.Fatalf("Invalid MEMORY_ENCRYPTION_KEY: %v", err)
+		}
+		sealedCollection, err = memServer.db.GetOrCreateCollection(collectionName+"_sealed", nil, nil)
+		if err != nil {
+			log.Fatalf("Failed to get/create sealed collection: %v", err)
+		}
+	}
+
+	// Re-embed stored memories if they were produced by an older schema, or
+	// refuse to start or only warn as MEMORY_SCHEMA_DRIFT says
+	schemaDrift := "reindex"
+	if action := os.Getenv("MEMORY_SCHEMA_DRIFT"); action != "" {
+		if !slices.Contains(schemaDriftActions, action) {
+			log.Fatalf("Invalid MEMORY_SCHEMA_DRIFT %q: must be one of %s", action, strings.Join(schemaDriftActions, ", "))
+		}
+		schemaDrift = action
+	}
+	schemaPath := filepath.Join(dbPath, collectionName+".schema.json")
+	if err := memServer.ensureSchema(context.Background(), collection, schemaPath, schemaDrift); err != nil {
+		log.Fatalf("Failed to check store schema: %v", err)
+	}
+
+	// releaseChildren applies MEMORY_CHILD_POLICY to the children of the
+	// deleted memory id, whose own parent was parentID: they either move up to
+	// parentID or are deleted too, recursively.
+	var releaseChildren func(ctx context.Context, id, parentID string)
+	releaseChildren = func(ctx context.Context, id, parentID string) {
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			log.Printf("Failed to list the children of %s: %v", id, err)
+			return
+		}
+
+		for _, child := range memoryChildren(memories, id) {
+			if childPolicy == "cascade" {
+				if err := collection.Delete(ctx, nil, nil, child.ID); err != nil {
+					log.Printf("Failed to delete %s with its parent %s: %v", child.ID, id, err)
+					continue
+				}
+				if err := recordChange("delete", child.ID, ""); err != nil {
+					log.Printf("Failed to record deletion of %s: %v", child.ID, err)
+				}
+				log.Printf("Deleted memory %s along with its parent %s", child.ID, id)
+				releaseChildren(ctx, child.ID, id)
+				continue
+			}
+
+			previous := chromem.Document{ID: child.ID, Metadata: child.Metadata, Embedding: child.Embedding, Content: child.Content}
+			updated := previous
+			updated.Metadata = maps.Clone(child.Metadata)
+			if parentID == "" {
+				delete(updated.Metadata, "parent")
+			} else {
+				updated.Metadata["parent"] = parentID
+			}
+			if err := saveUpdate(ctx, collection, recordChange, previous, updated); err != nil {
+				log.Printf("Failed to reparent %s: %v", child.ID, err)
+			}
+		}
+	}
+
+	// findMemory returns a memory and the collection holding it, which is the
+	// sealed one for encrypted memories.
+	findMemory := func(ctx context.Context, id string) (*chromem.Collection, chromem.Document, error) {
+		doc, err := collection.GetByID(ctx, id)
+		if err != nil && sealedCollection != nil {
+			if sealed, sealedErr := sealedCollection.GetByID(ctx, id); sealedErr == nil {
+				return sealedCollection, sealed, nil
+			}
+		}
+		return collection, doc, err
+	}
+
+	// deleteMemory deletes a memory, records the deletion and applies
+	// MEMORY_CHILD_POLICY to its children.
+	deleteMemory := func(ctx context.Context, id string) error {
+		from, doc, err := findMemory(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := from.Delete(ctx, nil, nil, id); err != nil {
+			return storageError(err)
+		}
+		if err := recordChange("delete", id, ""); err != nil {
+			log.Printf("Failed to record deletion of %s: %v", id, err)
+		}
+		releaseChildren(ctx, id, memoryParent(doc.Metadata))
+		return nil
+	}
+
+	// enforceLimits evicts the least recently active memories once the store
+	// grows past MEMORY_MAX_RECORDS or MEMORY_MAX_BYTES
+	enforceLimits := func(ctx context.Context) {
+		if maxRecords == 0 && maxBytes == 0 {
+			return
+		}
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			log.Printf("Eviction skipped: failed to list memories: %v", err)
+			return
+		}
+		// Encrypted memories count towards the limits too
+		if sealedCollection != nil {
+			sealed, err := listMemories(ctx, sealedCollection)
+			if err != nil {
+				log.Printf("Eviction skipped: failed to list encrypted memories: %v", err)
+				return
+			}
+			memories = append(memories, sealed...)
+		}
+
+		for _, id := range evictionCandidates(memories, maxRecords, maxBytes) {
+			// Cascading deletes may already have removed it
+			if _, _, err := findMemory(ctx, id); err != nil {
+				continue
+			}
+			if err := deleteMemory(ctx, id); err != nil {
+				log.Printf("Failed to evict %s: %v", id, err)
+				continue
+			}
+			log.Printf("Evicted memory %s to stay within store limits", id)
+		}
+	}
+
+	// Optionally delete memories of some types once they are older than the
+	// type's retention; types without a policy are kept forever
+	if spec := os.Getenv("MEMORY_RETENTION"); spec != "" {
+		policies, err := parseRetention(spec)
+		if err != nil {
+			log.Fatalf("Invalid MEMORY_RETENTION: %v", err)
+		}
+
+		shortest := time.Hour
+		for t, retention := range policies {
+			if canonical := synonyms.Canonical(t); canonical != t {
+				delete(policies, t)
+				policies[canonical] = retention
+			}
+			shortest = min(shortest, retention)
+		}
+
+		// The sweep deletes holding storeMu exclusively, so tool calls never
+		// see memories disappear half way through, e.g. between counting and
+		// querying
+		sweepRetention := func(ctx context.Context) {
+			storeMu.Lock()
+			defer storeMu.Unlock()
+
+			memories, err := listMemories(ctx, collection)
+			if err != nil {
+				log.Printf("Retention sweep skipped: failed to list memories: %v", err)
+				return
+			}
+
+			for t, ids := range retentionCandidates(memories, policies, synonyms.Canonical, time.Now()) {
+				deleted := 0
+				for _, id := range ids {
+					// Cascading deletes may already have removed it
+					if _, err := collection.GetByID(ctx, id); err != nil {
+						continue
+					}
+					if err := deleteMemory(ctx, id); err != nil {
+						log.Printf("Failed to delete expired memory %s: %v", id, err)
+						continue
+					}
+					deleted++
+				}
+				log.Printf("Deleted %d memories of type %q older than %s", deleted, t, policies[t])
+			}
+		}
+
+		stopRetention := make(chan struct{})
+		stops = append(stops, func() { close(stopRetention) })
+		go func() {
+			ticker := time.NewTicker(shortest)
+			defer ticker.Stop()
+			for {
+				sweepRetention(context.Background())
+				select {
+				case <-ticker.C:
+				case <-stopRetention:
+					return
+				}
+			}
+		}()
+	}
+
+	// checkType rejects types unknown in strict type mode. An empty type is
+	// always allowed.
+	checkType := func(ctx context.Context, t string) error {
+		if !strictTypes || t == "" {
+			return nil
+		}
+
+		counts, err := typeCounts(ctx, collection)
+		if err != nil {
+			return fmt.Errorf("failed to list types: %w", err)
+		}
+
+		allowed := append([]string(nil), knownTypes...)
+		for existing := range counts {
+			allowed = append(allowed, existing)
+		}
+
+		if !slices.Contains(allowed, t) {
+			return fmt.Errorf("unknown type %q; did you mean %q? (use list_types to see existing types)", t, closestType(t, allowed))
+		}
+		return nil
+	}
+
+	// validateMemory checks and normalizes the content and metadata of a new
+	// memory, returning the values to store.
+	validateMemory := func(ctx context.Context, content, metadata string, importance int) (string, string, error) {
+		content, err := checkUTF8("content", content, replaceInvalidUTF8)
+		if err != nil {
+			return "", "", err
+		}
+		metadata, err = checkUTF8("metadata", metadata, replaceInvalidUTF8)
+		if err != nil {
+			return "", "", err
+		}
+
+		metadata, err = applyDefaultType(metadata, defaultType)
+		if err != nil {
+			return "", "", err
+		}
+		if t := memoryType(metadata); synonyms.Canonical(t) != t {
+			if metadata, err = withType(metadata, synonyms.Canonical(t)); err != nil {
+				return "", "", err
+			}
+		}
+
+		content = normalizeContent(redact("a new memory", content), collapseWhitespace)
+		if content == "" {
+			return "", "", errors.New("content must not be empty")
+		}
+
+		if importance < minImportance || importance > maxImportance {
+			return "", "", fmt.Errorf("importance must be between %d and %d", minImportance, maxImportance)
+		}
+
+		if err := checkType(ctx, memoryType(metadata)); err != nil {
+			return "", "", err
+		}
+		return content, metadata, nil
+	}
+
+	// insertMemory validates, embeds and stores new content. parentID, if
+	// set, must already have been checked. It leaves enforcing the store
+	// limits to the caller, so a batch of memories is only checked once.
+	insertMemory := func(ctx context.Context, content, metadata string, importance int, related []string, parentID string) (chromem.Document, error) {
+		content, metadata, err := validateMemory(ctx, content, metadata, importance)
+		if err != nil {
+			return chromem.Document{}, err
+		}
+
+		// Generate embedding
+		embedding, err := memServer.embedMemory(ctx, content, metadata)
+		if err != nil {
+			return chromem.Document{}, fmt.Errorf("failed to generate embedding: %w", err)
+		}
+
+		// Create document
+		now := time.Now()
+		doc := chromem.Document{
+			ID: fmt.Sprintf("mem_%d", now.UnixNano()),
+			Metadata: map[string]string{
+				"raw_metadata": metadata,
+				"created_at":   now.UTC().Format(time.RFC3339Nano),
+				"importance":   strconv.Itoa(importance),
+			},
+			Embedding: embedding,
+			Content:   content,
+		}
+		if len(related) > 0 {
+			doc.Metadata["related"] = strings.Join(related, ",")
+		}
+		if parentID != "" {
+			doc.Metadata["parent"] = parentID
+		}
+
+		// Add to collection
+		if err := putDocument(ctx, collection, doc); err != nil {
+			return chromem.Document{}, fmt.Errorf("failed to add document: %w", err)
+		}
+
+		// Roll the add back if it can't be recorded, so replicas never miss it
+		if err := recordChange("add", doc.ID, doc.Content); err != nil {
+			collection.Delete(ctx, nil, nil, doc.ID)
+			return chromem.Document{}, fmt.Errorf("failed to record change: %w", err)
+		}
+
+		return doc, nil
+	}
+
+	// storeMemory inserts a single memory and enforces the store limits. It
+	// is shared by every tool that creates one memory.
+	storeMemory := func(ctx context.Context, content, metadata string, importance int, related []string, parentID string) (chromem.Document, error) {
+		doc, err := insertMemory(ctx, content, metadata, importance, related, parentID)
+		if err != nil {
+			return chromem.Document{}, err
+		}
+		enforceLimits(ctx)
+		return doc, nil
+	}
+
+	// storeSealedMemory validates and encrypts new content and stores it in
+	// the sealed collection. Its metadata stays readable for filtering.
+	storeSealedMemory := func(ctx context.Context, content, metadata string, importance int) (chromem.Document, error) {
+		if contentSealer == nil {
+			return chromem.Document{}, errors.New("encrypting memories requires MEMORY_ENCRYPTION_KEY to be set")
+		}
+
+		content, metadata, err := validateMemory(ctx, content, metadata, importance)
+		if err != nil {
+			return chromem.Document{}, err
+		}
+
+		sealed, err := contentSealer.Seal(content)
+		if err != nil {
+			return chromem.Document{}, fmt.Errorf("failed to encrypt content: %w", err)
+		}
+
+		now := time.Now()
+		doc := chromem.Document{
+			ID: fmt.Sprintf("mem_%d", now.UnixNano()),
+			Metadata: map[string]string{
+				"raw_metadata": metadata,
+				"created_at":   now.UTC().Format(time.RFC3339Nano),
+				"importance":   strconv.Itoa(importance),
+				"encrypted":    "true",
+			},
+			Embedding: sealedEmbedding(),
+			Content:   sealed,
+		}
+
+		if err := putDocument(ctx, sealedCollection, doc); err != nil {
+			return chromem.Document{}, fmt.Errorf("failed to add document: %w", err)
+		}
+		if err := recordChange("add", doc.ID, doc.Content); err != nil {
+			sealedCollection.Delete(ctx, nil, nil, doc.ID)
+			return chromem.Document{}, fmt.Errorf("failed to record change: %w", err)
+		}
+		enforceLimits(ctx)
+
+		return doc, nil
+	}
+
+	// Add memory storage tool
+	addMemoryTool := mcp.NewTool("add_memory",
+		mcp.WithDescription("Store text in ChromeDB with vector embeddings for semantic search"),
+		mcp.WithString("content",
+			mcp.Required(),
+			mcp.Description("Text content to store in the database"),
+		),
+		mcp.WithString("metadata",
+			mcp.Description("Optional JSON metadata for categorization"),
+		),
+		mcp.WithNumber("importance",
+			mcp.Description("Importance from 1 (trivial) to 5 (critical) (default: 3)"),
+			mcp.Min(minImportance),
+			mcp.Max(maxImportance),
+		),
+		mcp.WithBoolean("encrypt",
+			mcp.Description("Store the content encrypted with MEMORY_ENCRYPTION_KEY; it is then only readable through get_memories and never appears in search (default: false)"),
+		),
+	)
+
+	addTool(addMemoryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		content, ok := request.Params.Arguments["content"].(string)
+		if !ok {
+			return mcp.NewToolResultError("content must be a string"), nil
+		}
+
+		metadata := ""
+		if m, ok := request.Params.Arguments["metadata"].(string); ok {
+			metadata = m
+		}
+
+		importance := defaultImportance
+		if i, ok := request.Params.Arguments["importance"].(float64); ok {
+			importance = int(i)
+		}
+
+		var doc chromem.Document
+		var err error
+		if encrypt, _ := request.Params.Arguments["encrypt"].(bool); encrypt {
+			doc, err = storeSealedMemory(ctx, content, metadata, importance)
+		} else {
+			doc, err = storeMemory(ctx, content, metadata, importance, nil, "")
+		}
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		if requested, stored := memoryType(metadata), memoryType(doc.Metadata["raw_metadata"]); requested != "" && requested != stored {
+			return mcp.NewToolResultText(fmt.Sprintf("Memory stored with ID: %s (type %q normalized to %q)", doc.ID, requested, stored)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Memory stored with ID: %s", doc.ID)), nil
+	})
+
+	// Add encrypted memory listing tool
+	listSealedTool := mcp.NewTool("list_encrypted_memories",
+		mcp.WithDescription("List the IDs, types and creation times of encrypted memories without decrypting them"),
+		mcp.WithString("type",
+			mcp.Description("Only list encrypted memories with this metadata type"),
+		),
+	)
+
+	addTool(listSealedTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if sealedCollection == nil {
+			return mcp.NewToolResultError("encrypted memories require MEMORY_ENCRYPTION_KEY to be set"), nil
+		}
+		typeFilter, _ := request.Params.Arguments["type"].(string)
+		typeFilter = synonyms.Canonical(typeFilter)
+
+		memories, err := listMemories(ctx, sealedCollection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+		sort.Slice(memories, func(i, j int) bool { return memories[i].ID < memories[j].ID })
+
+		response := ""
+		listed := 0
+		for _, memory := range memories {
+			t := memoryType(memory.Metadata["raw_metadata"])
+			if typeFilter != "" && synonyms.Canonical(t) != typeFilter {
+				continue
+			}
+			createdAt, _ := memoryCreatedAt(memory.ID, memory.Metadata)
+			response += fmt.Sprintf("- %s (type: %q, created_at: %s)\n", memory.ID, t, timestamps.Format(createdAt))
+			listed++
+		}
+
+		if listed == 0 {
+			return mcp.NewToolResultText("No encrypted memories found."), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Found %d encrypted memories; fetch them with get_memories:\n\n%s", listed, response)), nil
+	})
+
+	// Add linked memory tool
+	addLinkedTool := mcp.NewTool("add_linked_memory",
+		mcp.WithDescription("Store a memory already linked to an existing parent memory"),
+		mcp.WithString("content",
+			mcp.Required(),
+			mcp.Description("Text content to store in the database"),
+		),
+		mcp.WithString("parentId",
+			mcp.Required(),
+			mcp.Description("ID of the existing memory to link the new one to"),
+		),
+		mcp.WithString("metadata",
+			mcp.Description("Optional JSON metadata for categorization"),
+		),
+		mcp.WithNumber("importance",
+			mcp.Description("Importance from 1 (trivial) to 5 (critical) (default: 3)"),
+			mcp.Min(minImportance),
+			mcp.Max(maxImportance),
+		),
+	)
+
+	addTool(addLinkedTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		content, ok := request.Params.Arguments["content"].(string)
+		if !ok {
+			return mcp.NewToolResultError("content must be a string"), nil
+		}
+
+		parentID, ok := request.Params.Arguments["parentId"].(string)
+		if !ok {
+			return mcp.NewToolResultError("parentId must be a string"), nil
+		}
+
+		metadata := ""
+		if m, ok := request.Params.Arguments["metadata"].(string); ok {
+			metadata = m
+		}
+
+		importance := defaultImportance
+		if i, ok := request.Params.Arguments["importance"].(float64); ok {
+			importance = int(i)
+		}
+
+		parent, err := collection.GetByID(ctx, parentID)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("parent memory not found: %v", err)), nil
+		}
+
+		// Eviction could remove the parent before it is linked back, so the
+		// store limits are only enforced once both ends are written
+		doc, err := insertMemory(ctx, content, metadata, importance, []string{parentID}, "")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		// Links are stored on both ends; undo the add if the parent can't be
+		// linked back so no one-sided link is left behind. A memory changed
+		// in the meantime is someone else's now and is kept.
+		if err := saveUpdate(ctx, collection, recordChange, parent, withLink(parent, doc.ID)); err != nil {
+			if current, getErr := collection.GetByID(ctx, doc.ID); getErr == nil && memoryVersion(current.Metadata) == memoryVersion(doc.Metadata) {
+				if deleteErr := deleteMemory(ctx, doc.ID); deleteErr != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to link to parent: %v; memory %s was stored unlinked and could not be removed: %v", err, doc.ID, deleteErr)), nil
+				}
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("failed to link to parent: %v", err)), nil
+		}
+		enforceLimits(ctx)
+
+		return mcp.NewToolResultText(fmt.Sprintf("Memory stored with ID: %s (linked to %s)", doc.ID, parentID)), nil
+	})
+
+	// Add related memories tool
+	getRelatedTool := mcp.NewTool("get_related",
+		mcp.WithDescription("List the memories directly linked to a memory"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the memory whose links to follow"),
+		),
+	)
+
+	addTool(getRelatedTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, ok := request.Params.Arguments["id"].(string)
+		if !ok {
+			return mcp.NewToolResultError("id must be a string"), nil
+		}
+
+		doc, err := collection.GetByID(ctx, id)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("memory not found: %v", err)), nil
+		}
+
+		links := memoryLinks(doc.Metadata)
+		if len(links) == 0 {
+			return mcp.NewToolResultText(fmt.Sprintf("Memory %s has no related memories.", id)), nil
+		}
+
+		response := fmt.Sprintf("Found %d related memories:\n\n", len(links))
+		for i, link := range links {
+			related, err := collection.GetByID(ctx, link)
+			if err != nil {
+				response += fmt.Sprintf("[%d] %s (missing)\n\n", i+1, link)
+				continue
+			}
+			response += fmt.Sprintf("[%d] %s: %s\n\n", i+1, related.ID, related.Content)
+		}
+
+		return mcp.NewToolResultText(response), nil
+	})
+
+	// Add hierarchy tools
+	addChildTool := mcp.NewTool("add_child_memory",
+		mcp.WithDescription("Store a memory as the child of an existing memory, building a tree such as an outline"),
+		mcp.WithString("content",
+			mcp.Required(),
+			mcp.Description("Text content to store in the database"),
+		),
+		mcp.WithString("parentId",
+			mcp.Required(),
+			mcp.Description("ID of the existing memory to nest the new one under"),
+		),
+		mcp.WithString("metadata",
+			mcp.Description("Optional JSON metadata for categorization"),
+		),
+		mcp.WithNumber("importance",
+			mcp.Description("Importance from 1 (trivial) to 5 (critical) (default: 3)"),
+			mcp.Min(minImportance),
+			mcp.Max(maxImportance),
+		),
+	)
+
+	addTool(addChildTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		content, ok := request.Params.Arguments["content"].(string)
+		if !ok {
+			return mcp.NewToolResultError("content must be a string"), nil
+		}
+
+		parentID, ok := request.Params.Arguments["parentId"].(string)
+		if !ok || parentID == "" {
+			return mcp.NewToolResultError("parentId must be a non-empty string"), nil
+		}
+
+		metadata := ""
+		if m, ok := request.Params.Arguments["metadata"].(string); ok {
+			metadata = m
+		}
+
+		importance := defaultImportance
+		if i, ok := request.Params.Arguments["importance"].(float64); ok {
+			importance = int(i)
+		}
+
+		// A new memory can't be anyone's ancestor, so only existence matters
+		if err := checkParent(ctx, collection, "", parentID); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		doc, err := storeMemory(ctx, content, metadata, importance, nil, parentID)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("Memory stored with ID: %s (child of %s)", doc.ID, parentID)), nil
+	})
+
+	moveTool := mcp.NewTool("move_memory",
+		mcp.WithDescription("Move a memory, with its descendants, under a different parent or to the top level"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the memory to move"),
+		),
+		mcp.WithString("parentId",
+			mcp.Description("ID of the new parent; omit to make the memory a root"),
+		),
+		mcp.WithNumber("expectedVersion",
+			mcp.Description("Only move if the memory is still at this version, as returned by get_memories"),
+		),
+	)
+
+	addTool(moveTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, ok := request.Params.Arguments["id"].(string)
+		if !ok {
+			return mcp.NewToolResultError("id must be a string"), nil
+		}
+		parentID, _ := request.Params.Arguments["parentId"].(string)
+
+		doc, err := collection.GetByID(ctx, id)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("memory not found: %v", err)), nil
+		}
+		if err := checkExpectedVersion(request.Params.Arguments, doc); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if err := checkParent(ctx, collection, id, parentID); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		updated := doc
+		updated.Metadata = maps.Clone(doc.Metadata)
+		if parentID == "" {
+			delete(updated.Metadata, "parent")
+		} else {
+			updated.Metadata["parent"] = parentID
+		}
+		if err := saveUpdate(ctx, collection, recordChange, doc, updated); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		if parentID == "" {
+			return mcp.NewToolResultText(fmt.Sprintf("Memory %s is now a root", id)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Memory %s moved under %s", id, parentID)), nil
+	})
+
+	getChildrenTool := mcp.NewTool("get_children",
+		mcp.WithDescription("List the direct children of a memory, oldest first"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the parent memory"),
+		),
+	)
+
+	addTool(getChildrenTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, ok := request.Params.Arguments["id"].(string)
+		if !ok {
+			return mcp.NewToolResultError("id must be a string"), nil
+		}
+
+		if _, err := collection.GetByID(ctx, id); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("memory not found: %v", err)), nil
+		}
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+
+		children := memoryChildren(memories, id)
+		if len(children) == 0 {
+			return mcp.NewToolResultText(fmt.Sprintf("Memory %s has no children.", id)), nil
+		}
+
+		response := fmt.Sprintf("Found %d children:\n\n", len(children))
+		for i, child := range children {
+			response += fmt.Sprintf("[%d] %s: %s\n\n", i+1, child.ID, child.Content)
+		}
+
+		return mcp.NewToolResultText(response), nil
+	})
+
+	getAncestorsTool := mcp.NewTool("get_ancestors",
+		mcp.WithDescription("List the path from a memory up to the root of its tree, nearest ancestor first"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the memory whose ancestry to list"),
+		),
+	)
+
+	addTool(getAncestorsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, ok := request.Params.Arguments["id"].(string)
+		if !ok {
+			return mcp.NewToolResultError("id must be a string"), nil
+		}
+
+		ancestors, err := memoryAncestors(ctx, collection, id)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if len(ancestors) == 0 {
+			return mcp.NewToolResultText(fmt.Sprintf("Memory %s is a root.", id)), nil
+		}
+
+		response := fmt.Sprintf("Found %d ancestors:\n\n", len(ancestors))
+		for i, ancestor := range ancestors {
+			response += fmt.Sprintf("[%d] %s: %s\n\n", i+1, ancestor.ID, ancestor.Content)
+		}
+
+		return mcp.NewToolResultText(response), nil
+	})
+
+	// Add batch lookup tool
+	getMemoriesTool := mcp.NewTool("get_memories",
+		mcp.WithDescription("Fetch several memories by ID in one call, as JSON"),
+		mcp.WithArray("ids",
+			mcp.Required(),
+			mcp.Description("IDs of the memories to fetch"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithArray("fields",
+			mcp.Description("Only include these fields of each memory: "+strings.Join(projectionFields, ", ")),
+			mcp.Items(map[string]any{"type": "string", "enum": projectionFields}),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent JSON output for readability (default: MEMORY_PRETTY_JSON)"),
+		),
+	)
+
+	addTool(getMemoriesTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		raw, ok := request.Params.Arguments["ids"].([]any)
+		if !ok {
+			return mcp.NewToolResultError("ids must be an array of strings"), nil
+		}
+
+		fields, err := parseFields(request.Params.Arguments)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if len(fields) == 0 {
+			fields = slices.DeleteFunc(slices.Clone(projectionFields), func(f string) bool { return f == "similarity" })
+		}
+
+		// Memories come back in request order; unknown IDs are listed
+		// separately rather than failing the whole call
+		memories := make([]map[string]any, 0, len(raw))
+		missing := []string{}
+		for _, r := range raw {
+			id, ok := r.(string)
+			if !ok {
+				return mcp.NewToolResultError(fmt.Sprintf("invalid id %v: ids must be strings", r)), nil
+			}
+
+			doc, err := collection.GetByID(ctx, id)
+			if err != nil && sealedCollection != nil {
+				// Encrypted memories are decrypted on the way out
+				if doc, err = sealedCollection.GetByID(ctx, id); err == nil {
+					if doc.Content, err = contentSealer.Open(doc.Content); err != nil {
+						return mcp.NewToolResultError(fmt.Sprintf("failed to read %s: %v", id, err)), nil
+					}
+				}
+			}
+			if err != nil {
+				missing = append(missing, id)
+				continue
+			}
+			memories = append(memories, projectMemory(chromem.Result{ID: doc.ID, Metadata: doc.Metadata, Content: doc.Content}, fields))
+		}
+
+		data, err := marshalJSON(map[string]any{
+			"memories": memories,
+			"missing":  missing,
+		}, wantPretty(request.Params.Arguments))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to encode memories: %v", err)), nil
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+
+	// Add diff tool
+	diffTool := mcp.NewTool("diff_memories",
+		mcp.WithDescription("Show how the content and metadata of two memories differ"),
+		mcp.WithString("from",
+			mcp.Required(),
+			mcp.Description("ID of the memory to compare from"),
+		),
+		mcp.WithString("to",
+			mcp.Required(),
+			mcp.Description("ID of the memory to compare to"),
+		),
+		mcp.WithString("granularity",
+			mcp.Description("Diff content by line, or by word for prose (default: line)"),
+			mcp.Enum("line", "word"),
+		),
+	)
+
+	addTool(diffTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		fromID, ok := request.Params.Arguments["from"].(string)
+		if !ok {
+			return mcp.NewToolResultError("from must be a string"), nil
+		}
+		toID, ok := request.Params.Arguments["to"].(string)
+		if !ok {
+			return mcp.NewToolResultError("to must be a string"), nil
+		}
+		granularity, _ := request.Params.Arguments["granularity"].(string)
+
+		from, err := collection.GetByID(ctx, fromID)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("memory not found: %v", err)), nil
+		}
+		to, err := collection.GetByID(ctx, toID)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("memory not found: %v", err)), nil
+		}
+
+		response := fmt.Sprintf("Comparing %s to %s:\n\n", fromID, toID)
+
+		// Metadata differences, one line each
+		fields := []struct {
+			name     string
+			from, to string
+		}{
+			{"Type", memoryType(from.Metadata["raw_metadata"]), memoryType(to.Metadata["raw_metadata"])},
+			{"Importance", strconv.Itoa(memoryImportance(from.Metadata)), strconv.Itoa(memoryImportance(to.Metadata))},
+			{"Metadata", from.Metadata["raw_metadata"], to.Metadata["raw_metadata"]},
+			{"Links", strings.Join(memoryLinks(from.Metadata), ", "), strings.Join(memoryLinks(to.Metadata), ", ")},
+		}
+		metadataChanged := false
+		for _, field := range fields {
+			if field.from != field.to {
+				response += fmt.Sprintf("%s: %q -> %q\n", field.name, field.from, field.to)
+				metadataChanged = true
+			}
+		}
+		if !metadataChanged {
+			response += "Metadata is identical.\n"
+		}
+		response += "\n"
+
+		if from.Content == to.Content {
+			return mcp.NewToolResultText(response + "Content is identical."), nil
+		}
+
+		var ops []diffOp
+		if granularity == "word" {
+			ops, err = diffTokens(strings.Fields(from.Content), strings.Fields(to.Content))
+		} else {
+			ops, err = diffTokens(strings.Split(from.Content, "\n"), strings.Split(to.Content, "\n"))
+		}
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		if granularity == "word" {
+			response += "Content:\n" + formatWordDiff(ops)
+		} else {
+			response += fmt.Sprintf("Content (- %s, + %s):\n", fromID, toID) + formatLineDiff(ops)
+		}
+		return mcp.NewToolResultText(response), nil
+	})
+
+	// Add broken link tool
+	brokenLinksTool := mcp.NewTool("find_broken_links",
+		mcp.WithDescription("List links that point to memories which no longer exist, optionally removing them"),
+		mcp.WithBoolean("prune",
+			mcp.Description("Remove the broken links from the memories holding them (default: false)"),
+		),
+	)
+
+	addTool(brokenLinksTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		prune, _ := request.Params.Arguments["prune"].(bool)
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+		sort.Slice(memories, func(i, j int) bool { return memories[i].ID < memories[j].ID })
+
+		ids := make(map[string]bool, len(memories))
+		for _, memory := range memories {
+			ids[memory.ID] = true
+		}
+
+		response := ""
+		broken, pruned := 0, 0
+		for _, memory := range memories {
+			links := memoryLinks(memory.Metadata)
+			valid := slices.DeleteFunc(slices.Clone(links), func(link string) bool { return !ids[link] })
+			if len(valid) == len(links) {
+				continue
+			}
+			missing := slices.DeleteFunc(slices.Clone(links), func(link string) bool { return ids[link] })
+			broken += len(missing)
+			response += fmt.Sprintf("- %s -> %s\n", memory.ID, strings.Join(missing, ", "))
+
+			if !prune {
+				continue
+			}
+			previous := chromem.Document{ID: memory.ID, Metadata: memory.Metadata, Embedding: memory.Embedding, Content: memory.Content}
+			updated := previous
+			updated.Metadata = maps.Clone(memory.Metadata)
+			if len(valid) == 0 {
+				delete(updated.Metadata, "related")
+			} else {
+				updated.Metadata["related"] = strings.Join(valid, ",")
+			}
+			if err := saveUpdate(ctx, collection, recordChange, previous, updated); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("pruned %d broken links, then: %v", pruned, err)), nil
+			}
+			pruned += len(missing)
+		}
+
+		if broken == 0 {
+			return mcp.NewToolResultText("No broken links found."), nil
+		}
+		if prune {
+			return mcp.NewToolResultText(fmt.Sprintf("Pruned %d broken links:\n\n%s", pruned, response)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Found %d broken links:\n\n%s", broken, response)), nil
+	})
+
+	// Add graph traversal tool
+	relatedGraphTool := mcp.NewTool("related_graph",
+		mcp.WithDescription("List all memories reachable from a memory through links, up to a number of hops"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the memory to start from"),
+		),
+		mcp.WithNumber("depth",
+			mcp.Description(fmt.Sprintf("Maximum number of hops to follow (default: 2, max: %d)", maxGraphDepth)),
+			mcp.Min(1),
+			mcp.Max(maxGraphDepth),
+		),
+	)
+
+	addTool(relatedGraphTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, ok := request.Params.Arguments["id"].(string)
+		if !ok {
+			return mcp.NewToolResultError("id must be a string"), nil
+		}
+
+		depth := 2
+		if d, ok := request.Params.Arguments["depth"].(float64); ok {
+			depth = min(int(d), maxGraphDepth)
+		}
+
+		nodes, err := relatedGraph(ctx, collection, id, depth)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("memory not found: %v", err)), nil
+		}
+
+		if len(nodes) == 1 {
+			return mcp.NewToolResultText(fmt.Sprintf("Memory %s has no related memories.", id)), nil
+		}
+
+		response := fmt.Sprintf("Found %d memories within %d hops of %s:\n\n", len(nodes)-1, depth, id)
+		for _, node := range nodes[1:] {
+			response += fmt.Sprintf("[hop %d] %s: %s\n\n", node.Depth, node.Memory.ID, node.Memory.Content)
+		}
+
+		return mcp.NewToolResultText(response), nil
+	})
+
+	// Add subgraph export tool
+	exportSubgraphTool := mcp.NewTool("export_subgraph",
+		mcp.WithDescription("Export a memory and every memory reachable from it through links as a self-contained JSON bundle with its edge list, importable with import_memories"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the memory at the root of the bundle"),
+		),
+		mcp.WithNumber("depth",
+			mcp.Description(fmt.Sprintf("Maximum number of hops to follow (default: 2, max: %d)", maxGraphDepth)),
+			mcp.Min(1),
+			mcp.Max(maxGraphDepth),
+		),
+		mcp.WithBoolean("compressed",
+			mcp.Description("Return the JSON gzipped and base64 encoded (default: false)"),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent JSON output for readability (default: MEMORY_PRETTY_JSON)"),
+		),
+	)
+
+	addTool(exportSubgraphTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, ok := request.Params.Arguments["id"].(string)
+		if !ok {
+			return mcp.NewToolResultError("id must be a string"), nil
+		}
+		depth := 2
+		if d, ok := request.Params.Arguments["depth"].(float64); ok {
+			depth = min(int(d), maxGraphDepth)
+		}
+		compressed, _ := request.Params.Arguments["compressed"].(bool)
+
+		nodes, err := relatedGraph(ctx, collection, id, depth)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("memory not found: %v", err)), nil
+		}
+
+		payload, err := encodeExport(exportSubgraph(nodes), compressed, wantPretty(request.Params.Arguments))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		return mcp.NewToolResultText(payload), nil
+	})
+
+	// cachedSearch runs a search through the search cache. Keyword fallback
+	// results aren't cached, so similarity search is retried once the
+	// embedding API recovers.
+	cachedSearch := func(ctx context.Context, opts searchOptions) (searchResult, error) {
+		res, generation, ok := cache.Get(opts)
+		if ok {
+			return res, nil
+		}
+		res, err := memServer.search(ctx, collection, opts, searchTimeout)
+		if err == nil && !res.Degraded {
+			cache.Put(opts, generation, res)
+		}
+		return res, err
+	}
+
+	// Add semantic search tool
+	searchToolOptions := append([]mcp.ToolOption{
+		mcp.WithDescription("Search ChromeDB for semantically similar content"),
+	}, searchArguments()...)
+	searchToolOptions = append(searchToolOptions,
+		mcp.WithArray("fields",
+			mcp.Description("Return results as JSON containing only these fields: "+strings.Join(projectionFields, ", ")),
+			mcp.Items(map[string]any{"type": "string", "enum": projectionFields}),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent JSON output for readability (default: MEMORY_PRETTY_JSON)"),
+		),
+	)
+	searchTool := mcp.NewTool("search_memory", searchToolOptions...)
+
+	addTool(searchTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		opts, err := parseSearchOptions(request.Params.Arguments, defaultSort)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		opts.KeywordFallback = searchFallback
+
+		fields, err := parseFields(request.Params.Arguments)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		res, err := cachedSearch(ctx, opts)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		render := func(res searchResult) (string, error) {
+			results := res.Results
+
+			if len(fields) > 0 {
+				projected := make([]map[string]any, 0, len(results))
+				for _, result := range results {
+					projected = append(projected, projectMemory(result, fields))
+				}
+				output := map[string]any{
+					"results":   projected,
+					"truncated": res.Truncated(),
+				}
+				if res.Counted() {
+					output["total"] = res.Total
+				}
+				if res.Truncated() {
+					output["nextOffset"] = res.NextOffset()
+				}
+				if res.Degraded {
+					output["degraded"] = true
+				}
+				data, err := marshalJSON(output, wantPretty(request.Params.Arguments))
+				if err != nil {
+					return "", fmt.Errorf("failed to encode results: %w", err)
+				}
+				return string(data), nil
+			}
+
+			degradedNote := ""
+			if res.Degraded {
+				degradedNote = "Embeddings are unavailable; results are from a keyword search (degraded mode).\n\n"
+			}
+
+			if len(results) == 0 {
+				return degradedNote + "No matching memories found.", nil
+			}
+
+			// Format results
+			response := fmt.Sprintf("Found %d relevant memories:\n\n", len(results))
+			if res.Suppressed > 0 {
+				response = fmt.Sprintf("Found %d relevant memories (%d duplicates suppressed):\n\n", len(results), res.Suppressed)
+			}
+			response = degradedNote + response
+			for i, result := range results {
+				if resultTemplate != nil {
+					rendered, err := renderMemory(resultTemplate, newMemoryView(res.Offset+i+1, result, titleMode, timestamps))
+					if err != nil {
+						return "", err
+					}
+					response += rendered
+					continue
+				}
+
+				response += fmt.Sprintf("[%d] %s (similarity: %.3f)\n", res.Offset+i+1, memoryTitle(result.Content, titleMode), result.Similarity)
+				if titleMode != "" {
+					response += fmt.Sprintf("   ID: %s\n", result.ID)
+				}
+				if metadata, ok := result.Metadata["raw_metadata"]; ok && metadata != "" {
+					response += fmt.Sprintf("   Metadata: %s\n", metadata)
+				}
+				response += "\n"
+			}
+			if res.Truncated() {
+				response += fmt.Sprintf("Showing %d-%d of %d matches; use offset %d for the next page.\n", res.Offset+1, res.NextOffset(), res.Total, res.NextOffset())
+			}
+			return response, nil
+		}
+
+		// Drop the lowest ranked results until the response fits; the
+		// paging hints then point at the first one left out
+		response, fitted, err := fitResponse(len(res.Results), maxResponseBytes, func(k int) (string, error) {
+			page := res
+			page.Results = res.Results[:k]
+			out, err := render(page)
+			if k < len(res.Results) && len(fields) == 0 {
+				out += fmt.Sprintf("Only %d of %d results fit in the %d byte response limit.\n", k, len(res.Results), maxResponseBytes)
+			}
+			return out, err
+		})
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if fitted == 0 && len(res.Results) > 0 {
+			return mcp.NewToolResultError(fmt.Sprintf("a single result exceeds the %d byte response limit; request fewer fields or raise MEMORY_MAX_RESPONSE_BYTES", maxResponseBytes)), nil
+		}
+
+		return mcp.NewToolResultText(response), nil
+	})
+
+	// Add batch search tool
+	batchSearchTool := mcp.NewTool("batch_search",
+		mcp.WithDescription("Run several searches in one call, returning a JSON array of result sets in the order of the queries"),
+		mcp.WithArray("queries",
+			mcp.Required(),
+			mcp.Description(fmt.Sprintf("Up to %d search specs, each an object taking the search_memory arguments (query, limit, offset, minImportance, fields, ...)", maxBatchQueries)),
+			mcp.Items(map[string]any{"type": "object"}),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent JSON output for readability (default: MEMORY_PRETTY_JSON)"),
+		),
+	)
+
+	addTool(batchSearchTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		raw, ok := request.Params.Arguments["queries"].([]any)
+		if !ok || len(raw) == 0 {
+			return mcp.NewToolResultError("queries must be a non-empty array of search specs"), nil
+		}
+		if len(raw) > maxBatchQueries {
+			return mcp.NewToolResultError(fmt.Sprintf("at most %d queries may be batched, got %d", maxBatchQueries, len(raw))), nil
+		}
+
+		// A failing spec only fails its own result set, so one bad query
+		// doesn't cost the caller the others
+		sets := make([]map[string]any, 0, len(raw))
+		for i, r := range raw {
+			spec, ok := r.(map[string]any)
+			if !ok {
+				sets = append(sets, map[string]any{"error": fmt.Sprintf("query %d must be an object", i)})
+				continue
+			}
+
+			set, err := func() (map[string]any, error) {
+				if strictArguments {
+					var unknown []string
+					for key := range spec {
+						if _, ok := searchTool.InputSchema.Properties[key]; !ok || key == "pretty" {
+							unknown = append(unknown, key)
+						}
+					}
+					if len(unknown) > 0 {
+						sort.Strings(unknown)
+						return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(unknown, ", "))
+					}
+				}
+
+				opts, err := parseSearchOptions(spec, defaultSort)
+				if err != nil {
+					return nil, err
+				}
+				opts.KeywordFallback = searchFallback
+
+				fields, err := parseFields(spec)
+				if err != nil {
+					return nil, err
+				}
+				if len(fields) == 0 {
+					fields = []string{"id", "content", "metadata", "similarity"}
+				}
+
+				res, err := cachedSearch(ctx, opts)
+				if err != nil {
+					return nil, err
+				}
+
+				projected := make([]map[string]any, 0, len(res.Results))
+				for _, result := range res.Results {
+					projected = append(projected, projectMemory(result, fields))
+				}
+				set := map[string]any{
+					"query":     opts.Query,
+					"results":   projected,
+					"truncated": res.Truncated(),
+				}
+				if res.Counted() {
+					set["total"] = res.Total
+				}
+				if res.Truncated() {
+					set["nextOffset"] = res.NextOffset()
+				}
+				if res.Degraded {
+					set["degraded"] = true
+				}
+				return set, nil
+			}()
+			if err != nil {
+				set = map[string]any{"error": err.Error()}
+				if query, ok := spec["query"].(string); ok {
+					set["query"] = query
+				}
+			}
+			sets = append(sets, set)
+		}
+
+		data, err := marshalJSON(sets, wantPretty(request.Params.Arguments))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to encode results: %v", err)), nil
+		}
+		if maxResponseBytes > 0 && len(data) > maxResponseBytes {
+			return mcp.NewToolResultError(fmt.Sprintf("results exceed the %d byte response limit; lower the limits, request fewer fields or split the batch", maxResponseBytes)), nil
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+
+	// Add prompt context tool
+	recallTool := mcp.NewTool("recall",
+		mcp.WithDescription("Collect the most relevant memories for a query into one block of text that fits a prompt budget"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("What the prompt is about"),
+		),
+		mcp.WithNumber("maxChars",
+			mcp.Description("Maximum size of the returned text in characters (default: 4000)"),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("maxTokens",
+			mcp.Description("Maximum size in tokens, estimated at 4 characters per token; overrides maxChars"),
+			mcp.Min(1),
+		),
+	)
+
+	addTool(recallTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		query, ok := request.Params.Arguments["query"].(string)
+		if !ok {
+			return mcp.NewToolResultError("query must be a string"), nil
+		}
+
+		maxChars := 4000
+		if m, ok := request.Params.Arguments["maxChars"].(float64); ok {
+			maxChars = int(m)
+		}
+		if m, ok := request.Params.Arguments["maxTokens"].(float64); ok {
+			maxChars = int(m) * 4
+		}
+
+		results, err := memServer.searchMemories(ctx, collection, query, 50, searchTimeout)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		// Take memories in relevance order until the next one would not fit
+		var sb strings.Builder
+		included, used := 0, 0
+		for _, result := range results {
+			entry := fmt.Sprintf("--- memory %s ---\n%s\n\n", result.ID, result.Content)
+			size := utf8.RuneCountInString(entry)
+			if used+size > maxChars {
+				break
+			}
+			sb.WriteString(entry)
+			included++
+			used += size
+		}
+
+		if included == 0 {
+			return mcp.NewToolResultText("No memories fit within the budget."), nil
+		}
+
+		return mcp.NewToolResultText(sb.String()), nil
+	})
+
+	// Add compile tool
+	compileTool := mcp.NewTool("compile",
+		mcp.WithDescription("Run a search and return the full content of every hit above a similarity threshold as one markdown document, with a header per memory, e.g. to feed a summarizer"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("What the document should be about"),
+		),
+		mcp.WithNumber("minScore",
+			mcp.Description("Minimum similarity, from 0 to 1, for a memory to be included (default: 0)"),
+			mcp.Min(0),
+			mcp.Max(1),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of memories to include (default: 20)"),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("maxChars",
+			mcp.Description("Maximum size of the document in characters; lower ranked memories that don't fit are left out (default: 16000)"),
+			mcp.Min(1),
+		),
+	)
+
+	addTool(compileTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		query, ok := request.Params.Arguments["query"].(string)
+		if !ok {
+			return mcp.NewToolResultError("query must be a string"), nil
+		}
+		minScore, _ := request.Params.Arguments["minScore"].(float64)
+		limit := 20
+		if l, ok := request.Params.Arguments["limit"].(float64); ok {
+			limit = int(l)
+		}
+		maxChars := 16000
+		if m, ok := request.Params.Arguments["maxChars"].(float64); ok {
+			maxChars = int(m)
+		}
+		if limit < 1 || maxChars < 1 {
+			return mcp.NewToolResultError("limit and maxChars must be at least 1"), nil
+		}
+
+		results, err := memServer.searchMemories(ctx, collection, query, limit, searchTimeout)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		// Results come most similar first, so the first one below the
+		// threshold ends the document
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "# %s\n\n", query)
+		used := utf8.RuneCountInString(sb.String())
+		included, omitted := 0, 0
+		for _, result := range results {
+			if float64(result.Similarity) < minScore {
+				break
+			}
+
+			header := fmt.Sprintf("## %s (similarity: %.3f)\n\n", result.ID, result.Similarity)
+			if t := memoryType(result.Metadata["raw_metadata"]); t != "" {
+				header = fmt.Sprintf("## %s (type: %s, similarity: %.3f)\n\n", result.ID, t, result.Similarity)
+			}
+			section := header + result.Content + "\n\n"
+			size := utf8.RuneCountInString(section)
+			if used+size > maxChars {
+				omitted++
+				continue
+			}
+			sb.WriteString(section)
+			used += size
+			included++
+		}
+
+		if included == 0 {
+			if omitted > 0 {
+				return mcp.NewToolResultText(fmt.Sprintf("%d memories matched, but none fits within %d characters.", omitted, maxChars)), nil
+			}
+			return mcp.NewToolResultText("No memories matched above the threshold."), nil
+		}
+		if omitted > 0 {
+			fmt.Fprintf(&sb, "_%d more matching memories didn't fit within %d characters._\n", omitted, maxChars)
+		}
+
+		return mcp.NewToolResultText(sb.String()), nil
+	})
+
+	// Add importance tool
+	setImportanceTool := mcp.NewTool("set_importance",
+		mcp.WithDescription("Change the importance of a stored memory"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the memory to update"),
+		),
+		mcp.WithNumber("importance",
+			mcp.Required(),
+			mcp.Description("Importance from 1 (trivial) to 5 (critical)"),
+			mcp.Min(minImportance),
+			mcp.Max(maxImportance),
+		),
+		mcp.WithNumber("expectedVersion",
+			mcp.Description("Only update if the memory is still at this version, as returned by get_memories"),
+		),
+	)
+
+	addTool(setImportanceTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, ok := request.Params.Arguments["id"].(string)
+		if !ok {
+			return mcp.NewToolResultError("id must be a string"), nil
+		}
+
+		i, ok := request.Params.Arguments["importance"].(float64)
+		if !ok {
+			return mcp.NewToolResultError("importance must be a number"), nil
+		}
+		importance := int(i)
+		if importance < minImportance || importance > maxImportance {
+			return mcp.NewToolResultError(fmt.Sprintf("importance must be between %d and %d", minImportance, maxImportance)), nil
+		}
+
+		doc, err := collection.GetByID(ctx, id)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("memory not found: %v", err)), nil
+		}
+		if err := checkExpectedVersion(request.Params.Arguments, doc); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		updated := doc
+		updated.Metadata = maps.Clone(doc.Metadata)
+		updated.Metadata["importance"] = strconv.Itoa(importance)
+		if err := saveUpdate(ctx, collection, recordChange, doc, updated); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("Importance of %s set to %d", id, importance)), nil
+	})
+
+	// Add touch tool
+	touchTool := mcp.NewTool("touch_memory",
+		mcp.WithDescription("Mark a memory as recently relevant by refreshing its updated_at time without changing it"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the memory to touch"),
+		),
+		mcp.WithNumber("expectedVersion",
+			mcp.Description("Only update if the memory is still at this version, as returned by get_memories"),
+		),
+	)
+
+	addTool(touchTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, ok := request.Params.Arguments["id"].(string)
+		if !ok {
+			return mcp.NewToolResultError("id must be a string"), nil
+		}
+
+		doc, err := collection.GetByID(ctx, id)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("memory not found: %v", err)), nil
+		}
+		if err := checkExpectedVersion(request.Params.Arguments, doc); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		if err := saveUpdate(ctx, collection, recordChange, doc, doc); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("Memory %s touched", id)), nil
+	})
+
+	// Add search explanation tool
+	explainTool := mcp.NewTool("explain_search",
+		mcp.WithDescription("Debug a search: show each candidate's similarity and which search_memory filters would drop it"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("Search query to explain"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Number of top candidates to explain (default: 10)"),
+			mcp.Min(1),
+			mcp.Max(100),
+		),
+		mcp.WithNumber("minImportance",
+			mcp.Description("Importance filter to evaluate"),
+			mcp.Min(minImportance),
+			mcp.Max(maxImportance),
+		),
+		mcp.WithNumber("minMatch",
+			mcp.Description("Keyword match filter to evaluate"),
+			mcp.Min(1),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent JSON output for readability (default: MEMORY_PRETTY_JSON)"),
+		),
+	)
+
+	addTool(explainTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		query, ok := request.Params.Arguments["query"].(string)
+		if !ok {
+			return mcp.NewToolResultError("query must be a string"), nil
+		}
+
+		limit := 10
+		if l, ok := request.Params.Arguments["limit"].(float64); ok {
+			limit = int(l)
+		}
+
+		minImp := 0
+		if m, ok := request.Params.Arguments["minImportance"].(float64); ok {
+			minImp = int(m)
+		}
+
+		minMatch := 0
+		if m, ok := request.Params.Arguments["minMatch"].(float64); ok {
+			minMatch = int(m)
+		}
+
+		results, err := memServer.searchMemories(ctx, collection, query, limit, searchTimeout)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		type explanation struct {
+			Rank         int      `json:"rank"`
+			ID           string   `json:"id"`
+			Similarity   float32  `json:"similarity"`
+			Importance   int      `json:"importance"`
+			MatchedTerms int      `json:"matched_terms"`
+			QueryTerms   int      `json:"query_terms"`
+			ExcludedBy   []string `json:"excluded_by,omitempty"`
+		}
+
+		queryTerms := len(tokenize(query))
+		explanations := make([]explanation, 0, len(results))
+		for i, result := range results {
+			e := explanation{
+				Rank:         i + 1,
+				ID:           result.ID,
+				Similarity:   result.Similarity,
+				Importance:   memoryImportance(result.Metadata),
+				MatchedTerms: matchedTerms(query, result.Content, false),
+				QueryTerms:   queryTerms,
+			}
+			if minImp > 0 && e.Importance < minImp {
+				e.ExcludedBy = append(e.ExcludedBy, fmt.Sprintf("minImportance=%d", minImp))
+			}
+			if minMatch > 0 && e.MatchedTerms < minMatch {
+				e.ExcludedBy = append(e.ExcludedBy, fmt.Sprintf("minMatch=%d", minMatch))
+			}
+			explanations = append(explanations, e)
+		}
+
+		data, err := marshalJSON(explanations, wantPretty(request.Params.Arguments))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to encode explanation: %v", err)), nil
+		}
+
+		return mcp.NewToolResultText(string(data)), nil
+	})
+
+	// Add text analysis tool
+	analyzeTool := mcp.NewTool("analyze_text",
+		mcp.WithDescription("Show the words text is split into by the word-level search features (minMatch, excludeQuery, keyword fallback and suggest), to debug why a term does or doesn't match. Similarity ranking works on embeddings and isn't affected"),
+		mcp.WithString("text",
+			mcp.Required(),
+			mcp.Description("Text to analyze"),
+		),
+		mcp.WithBoolean("caseSensitive",
+			mcp.Description("Keep words in their written case, as caseSensitive searches do (default: false)"),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent JSON output for readability (default: MEMORY_PRETTY_JSON)"),
+		),
+	)
+
+	addTool(analyzeTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		text, ok := request.Params.Arguments["text"].(string)
+		if !ok {
+			return mcp.NewToolResultError("text must be a string"), nil
+		}
+
+		tokens := tokenize(text)
+		if caseSensitive, _ := request.Params.Arguments["caseSensitive"].(bool); caseSensitive {
+			tokens = splitWords(text)
+		}
+		if tokens == nil {
+			tokens = []string{}
+		}
+
+		data, err := marshalJSON(map[string]any{"tokens": tokens}, wantPretty(request.Params.Arguments))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to encode tokens: %v", err)), nil
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+
+	// Add find and replace tool
+	findReplaceTool := mcp.NewTool("find_replace",
+		mcp.WithDescription("Replace text inside the content of all matching memories, re-embedding the ones that change"),
+		mcp.WithString("find",
+			mcp.Required(),
+			mcp.Description("Text or regular expression to find"),
+		),
+		mcp.WithString("replace",
+			mcp.Required(),
+			mcp.Description("Replacement text; with regex, $1 etc. refer to capture groups"),
+		),
+		mcp.WithBoolean("regex",
+			mcp.Description("Treat find as an RE2 regular expression (default: false)"),
+		),
+		mcp.WithString("type",
+			mcp.Description("Only change memories with this metadata type"),
+		),
+		mcp.WithBoolean("dryRun",
+			mcp.Description("Report the affected memories and their new content without changing anything (default: false)"),
+		),
+	)
+
+	addTool(findReplaceTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		find, ok := request.Params.Arguments["find"].(string)
+		if !ok || find == "" {
+			return mcp.NewToolResultError("find must be a non-empty string"), nil
+		}
+		replace, ok := request.Params.Arguments["replace"].(string)
+		if !ok {
+			return mcp.NewToolResultError("replace must be a string"), nil
+		}
+		useRegex, _ := request.Params.Arguments["regex"].(bool)
+		typeFilter, _ := request.Params.Arguments["type"].(string)
+		typeFilter = synonyms.Canonical(typeFilter)
+		dryRun, _ := request.Params.Arguments["dryRun"].(bool)
+
+		// RE2 matches in linear time, so no pattern can backtrack
+		// catastrophically
+		pattern := regexp.QuoteMeta(find)
+		if useRegex {
+			pattern = find
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid regular expression: %v", err)), nil
+		}
+		if !useRegex {
+			replace = strings.ReplaceAll(replace, "$", "$$")
+		}
+
+		// The pass over a large store stops with a partial result after
+		// searchTimeout, while each memory's update gets its own deadline so
+		// the last one isn't cut short
+		deadline := time.Now().Add(searchTimeout)
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+		sort.Slice(memories, func(i, j int) bool { return memories[i].ID < memories[j].ID })
+
+		response := ""
+		changed := 0
+		for _, memory := range memories {
+			if time.Now().After(deadline) {
+				response += fmt.Sprintf("\nStopped after %s; run again to continue.\n", searchTimeout)
+				break
+			}
+			if typeFilter != "" && synonyms.Canonical(memoryType(memory.Metadata["raw_metadata"])) != typeFilter {
+				continue
+			}
+			// Normalizing alone mustn't count as a change
+			if !re.MatchString(memory.Content) {
+				continue
+			}
+
+			content := normalizeContent(re.ReplaceAllString(memory.Content, replace), collapseWhitespace)
+			if content == memory.Content {
+				continue
+			}
+			content = redact(memory.ID, content)
+			if content == "" {
+				response += fmt.Sprintf("- %s: skipped, replacement would leave it empty\n", memory.ID)
+				continue
+			}
+
+			if dryRun {
+				response += fmt.Sprintf("- %s:\n    before: %s\n    after:  %s\n", memory.ID, memory.Content, content)
+				changed++
+				continue
+			}
+
+			err := func() error {
+				ctx, cancel := context.WithTimeout(ctx, searchTimeout)
+				defer cancel()
+
+				embedding, err := memServer.embedMemory(ctx, content, memory.Metadata["raw_metadata"])
+				if err != nil {
+					return fmt.Errorf("failed to generate embedding for %s: %w", memory.ID, err)
+				}
+
+				previous := chromem.Document{ID: memory.ID, Metadata: memory.Metadata, Embedding: memory.Embedding, Content: memory.Content}
+				updated := chromem.Document{ID: memory.ID, Metadata: memory.Metadata, Embedding: embedding, Content: content}
+				return saveUpdate(ctx, collection, recordChange, previous, updated)
+			}()
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("updated %d memories, then: %v", changed, err)), nil
+			}
+			response += fmt.Sprintf("- %s\n", memory.ID)
+			changed++
+		}
+
+		if dryRun {
+			return mcp.NewToolResultText(fmt.Sprintf("Dry run: %d memories would change:\n\n%s", changed, response)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Updated %d memories:\n\n%s", changed, response)), nil
+	})
+
+	// Add retype tool
+	retypeToolOptions := append([]mcp.ToolOption{
+		mcp.WithDescription(fmt.Sprintf("Change the metadata type of every memory matching a search, not just one page: "+
+			"those at least minSimilarity similar to the query (default: %.1f) that pass the filters. limit and offset are ignored", defaultMinSimilarity)),
+	}, searchArguments()...)
+	retypeToolOptions = append(retypeToolOptions,
+		mcp.WithString("type",
+			mcp.Required(),
+			mcp.Description("Type to give the matching memories"),
+		),
+		mcp.WithString("fromType",
+			mcp.Description("Only change matching memories that currently have this type"),
+		),
+		mcp.WithBoolean("dryRun",
+			mcp.Description("Report the affected memories without changing anything (default: false)"),
+		),
+	)
+	retypeTool := mcp.NewTool("retype_by_query", retypeToolOptions...)
+
+	addTool(retypeTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		opts, err := parseSearchOptions(request.Params.Arguments, defaultSort)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		newType, ok := request.Params.Arguments["type"].(string)
+		if !ok || strings.TrimSpace(newType) == "" {
+			return mcp.NewToolResultError("type must be a non-empty string"), nil
+		}
+		newType = synonyms.Canonical(newType)
+		fromType, _ := request.Params.Arguments["fromType"].(string)
+		fromType = synonyms.Canonical(fromType)
+		dryRun, _ := request.Params.Arguments["dryRun"].(bool)
+
+		if err := checkType(ctx, newType); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		// Take every match in one page. A plain similarity search matches
+		// every memory, so it needs a threshold like count_search.
+		if _, ok := request.Params.Arguments["minSimilarity"]; !ok {
+			opts.MinSimilarity = defaultMinSimilarity
+		}
+		opts.Offset, opts.Limit = 0, max(collection.Count(), 1)
+
+		res, err := memServer.search(ctx, collection, opts, searchTimeout)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		response := ""
+		changed := 0
+		for _, result := range res.Results {
+			oldType := memoryType(result.Metadata["raw_metadata"])
+			if oldType == newType || (fromType != "" && synonyms.Canonical(oldType) != fromType) {
+				continue
+			}
+
+			raw, err := withType(result.Metadata["raw_metadata"], newType)
+			if err != nil {
+				response += fmt.Sprintf("- %s: skipped, %v\n", result.ID, err)
+				continue
+			}
+
+			if !dryRun {
+				previous := chromem.Document{ID: result.ID, Metadata: result.Metadata, Embedding: result.Embedding, Content: result.Content}
+				updated := previous
+				updated.Metadata = maps.Clone(result.Metadata)
+				updated.Metadata["raw_metadata"] = raw
+				if memServer.embedMetadata {
+					if updated.Embedding, err = memServer.embedMemory(ctx, updated.Content, raw); err != nil {
+						return mcp.NewToolResultError(fmt.Sprintf("retyped %d memories, then failed to generate embedding for %s: %v", changed, result.ID, err)), nil
+					}
+				}
+				if err := saveUpdate(ctx, collection, recordChange, previous, updated); err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("retyped %d memories, then: %v", changed, err)), nil
+				}
+			}
+			response += fmt.Sprintf("- %s: %q -> %q\n", result.ID, oldType, newType)
+			changed++
+		}
+
+		if dryRun {
+			return mcp.NewToolResultText(fmt.Sprintf("Dry run: %d of %d matching memories would be retyped:\n\n%s", changed, len(res.Results), response)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Retyped %d of %d matching memories:\n\n%s", changed, len(res.Results), response)), nil
+	})
+
+	// Add type consolidation tool
+	consolidateTool := mcp.NewTool("consolidate_types",
+		mcp.WithDescription("Fold several metadata types into one across the whole store, e.g. \"ml\", \"ML\" and \"machine learning\" into \"machine-learning\""),
+		mcp.WithArray("sources",
+			mcp.Required(),
+			mcp.Description("Types to replace; synonyms from MEMORY_TYPE_SYNONYMS match their preferred type"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("type",
+			mcp.Required(),
+			mcp.Description("Type to give memories of any source type"),
+		),
+		mcp.WithBoolean("dryRun",
+			mcp.Description("Count the affected memories without changing anything (default: false)"),
+		),
+	)
+
+	addTool(consolidateTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		raw, ok := request.Params.Arguments["sources"].([]any)
+		if !ok || len(raw) == 0 {
+			return mcp.NewToolResultError("sources must be a non-empty array of strings"), nil
+		}
+		newType, ok := request.Params.Arguments["type"].(string)
+		if !ok || strings.TrimSpace(newType) == "" {
+			return mcp.NewToolResultError("type must be a non-empty string"), nil
+		}
+		newType = synonyms.Canonical(newType)
+		dryRun, _ := request.Params.Arguments["dryRun"].(bool)
+
+		// Sources are counted by preferred type, so synonyms listed together
+		// aren't reported twice and memories stored under an older synonym
+		// still match
+		counts := make(map[string]int, len(raw))
+		var sources []string
+		for _, r := range raw {
+			source, ok := r.(string)
+			if !ok || source == "" {
+				return mcp.NewToolResultError(fmt.Sprintf("invalid source type %v: sources must be non-empty strings", r)), nil
+			}
+			source = synonyms.Canonical(source)
+			if _, seen := counts[source]; !seen {
+				counts[source] = 0
+				sources = append(sources, source)
+			}
+		}
+
+		if err := checkType(ctx, newType); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+
+		changed := 0
+		skipped := ""
+		for _, memory := range memories {
+			oldType := memoryType(memory.Metadata["raw_metadata"])
+			source := synonyms.Canonical(oldType)
+			if _, ok := counts[source]; !ok || oldType == newType {
+				continue
+			}
+
+			metadata, err := withType(memory.Metadata["raw_metadata"], newType)
+			if err != nil {
+				skipped += fmt.Sprintf("- %s: skipped, %v\n", memory.ID, err)
+				continue
+			}
+
+			if !dryRun {
+				previous := chromem.Document{ID: memory.ID, Metadata: memory.Metadata, Embedding: memory.Embedding, Content: memory.Content}
+				updated := previous
+				updated.Metadata = maps.Clone(memory.Metadata)
+				updated.Metadata["raw_metadata"] = metadata
+				if memServer.embedMetadata {
+					if updated.Embedding, err = memServer.embedMemory(ctx, updated.Content, metadata); err != nil {
+						return mcp.NewToolResultError(fmt.Sprintf("retyped %d memories, then failed to generate embedding for %s: %v", changed, memory.ID, err)), nil
+					}
+				}
+				if err := saveUpdate(ctx, collection, recordChange, previous, updated); err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("retyped %d memories, then: %v", changed, err)), nil
+				}
+			}
+			counts[source]++
+			changed++
+		}
+
+		response := ""
+		for _, source := range sources {
+			response += fmt.Sprintf("- %q: %d\n", source, counts[source])
+		}
+		response += skipped
+
+		if dryRun {
+			return mcp.NewToolResultText(fmt.Sprintf("Dry run: %d memories would be retyped to %q:\n\n%s", changed, newType, response)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Retyped %d memories to %q:\n\n%s", changed, newType, response)), nil
+	})
+
+	// Add targeted re-embedding tool
+	reembedTool := mcp.NewTool("reembed_memories",
+		mcp.WithDescription("Regenerate the embeddings of only the memories matching a filter, leaving their content unchanged"),
+		mcp.WithString("type",
+			mcp.Description("Only re-embed memories with this metadata type"),
+		),
+		mcp.WithString("contains",
+			mcp.Description("Only re-embed memories whose content contains this text"),
+		),
+		mcp.WithBoolean("dryRun",
+			mcp.Description("Count the matching memories without re-embedding them (default: false)"),
+		),
+	)
+
+	addTool(reembedTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		typeFilter, _ := request.Params.Arguments["type"].(string)
+		typeFilter = synonyms.Canonical(typeFilter)
+		contains, _ := request.Params.Arguments["contains"].(string)
+		dryRun, _ := request.Params.Arguments["dryRun"].(bool)
+		if typeFilter == "" && contains == "" {
+			return mcp.NewToolResultError("give a type or contains filter; re-embedding everything happens automatically when the embedding model changes"), nil
+		}
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+
+		matches := memories[:0]
+		for _, memory := range memories {
+			if typeFilter != "" && synonyms.Canonical(memoryType(memory.Metadata["raw_metadata"])) != typeFilter {
+				continue
+			}
+			if contains != "" && !strings.Contains(memory.Content, contains) {
+				continue
+			}
+			matches = append(matches, memory)
+		}
+
+		if dryRun {
+			return mcp.NewToolResultText(fmt.Sprintf("Dry run: %d memories would be re-embedded.", len(matches))), nil
+		}
+
+		// Re-embedding isn't a recorded change but does move search results
+		updated, err := memServer.reembed(ctx, collection, matches)
+		cache.Invalidate()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("re-embedded %d of %d memories, then: %v", updated, len(matches), err)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Re-embedded %d memories.", updated)), nil
+	})
+
+	// Add review tool
+	needsReviewTool := mcp.NewTool("needs_review",
+		mcp.WithDescription("List memories that have gone untouched for long relative to their importance, most stale first, so they can be refreshed or removed"),
+		mcp.WithNumber("staleDays",
+			mcp.Description("Days a memory of default importance may go untouched; lower importance shortens this and higher lengthens it proportionally (default: 90)"),
+			mcp.Min(1),
+		),
+		mcp.WithString("type",
+			mcp.Description("Only review memories with this metadata type"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of memories (default: 20)"),
+			mcp.Min(1),
+			mcp.Max(100),
+		),
+	)
+
+	addTool(needsReviewTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		staleDays := 90.0
+		if d, ok := request.Params.Arguments["staleDays"].(float64); ok {
+			staleDays = d
+		}
+		if staleDays <= 0 {
+			return mcp.NewToolResultError("staleDays must be positive"), nil
+		}
+		limit := 20
+		if l, ok := request.Params.Arguments["limit"].(float64); ok {
+			limit = int(l)
+		}
+		typeFilter, _ := request.Params.Arguments["type"].(string)
+		typeFilter = synonyms.Canonical(typeFilter)
+		staleAfter := time.Duration(staleDays * float64(24*time.Hour))
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+
+		type candidate struct {
+			memory   chromem.Result
+			inactive time.Duration
+		}
+		now := time.Now()
+		var candidates []candidate
+		for _, memory := range memories {
+			if typeFilter != "" && synonyms.Canonical(memoryType(memory.Metadata["raw_metadata"])) != typeFilter {
+				continue
+			}
+			inactive := now.Sub(memoryLastActive(memory.ID, memory.Metadata))
+			if inactive < reviewAfter(staleAfter, memoryImportance(memory.Metadata)) {
+				continue
+			}
+			candidates = append(candidates, candidate{memory, inactive})
+		}
+		if len(candidates) == 0 {
+			return mcp.NewToolResultText("No memories need review."), nil
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			if candidates[i].inactive != candidates[j].inactive {
+				return candidates[i].inactive > candidates[j].inactive
+			}
+			return candidates[i].memory.ID < candidates[j].memory.ID
+		})
+
+		entries := make([]string, 0, min(limit, len(candidates)))
+		for i, c := range candidates[:min(limit, len(candidates))] {
+			entries = append(entries, fmt.Sprintf("[%d] %s (untouched %d days, importance %d)\n   ID: %s\n\n",
+				i+1, memoryTitle(c.memory.Content, titleMode), int(c.inactive.Hours()/24), memoryImportance(c.memory.Metadata), c.memory.ID))
+		}
+
+		header := fmt.Sprintf("Found %d memories needing review:\n\n", len(candidates))
+		if len(candidates) > limit {
+			header = fmt.Sprintf("Found %d memories needing review, showing the %d most stale:\n\n", len(candidates), limit)
+		}
+		return mcp.NewToolResultText(fitEntries(header, entries, maxResponseBytes)), nil
+	})
+
+	// Add search count tool
+	countSearchTool := mcp.NewTool("count_search", append([]mcp.ToolOption{
+		mcp.WithDescription(fmt.Sprintf("Count the memories search_memory would match for a query, without returning them. "+
+			"A memory matches when it is at least minSimilarity similar to the query (default: %.1f) and passes the filters", defaultMinSimilarity)),
+	}, searchArguments()...)...)
+
+	addTool(countSearchTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		opts, err := parseSearchOptions(request.Params.Arguments, defaultSort)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		opts.KeywordFallback = searchFallback
+		// A plain similarity search matches every memory, so counting needs
+		// a threshold
+		if _, ok := request.Params.Arguments["minSimilarity"]; !ok {
+			opts.MinSimilarity = defaultMinSimilarity
+		}
+
+		res, err := cachedSearch(ctx, opts)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		total := res.Total
+		if !res.Counted() {
+			total = collection.Count()
+		}
+
+		if res.Degraded {
+			return mcp.NewToolResultText(fmt.Sprintf("%d matching memories (keyword search; embeddings are unavailable)", total)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("%d matching memories (similarity >= %.2f)", total, opts.MinSimilarity)), nil
+	})
+
+	// Add date lookup tool
+	onDateTool := mcp.NewTool("memories_on_date",
+		mcp.WithDescription("Retrieve all memories created on a specific day"),
+		mcp.WithString("date",
+			mcp.Required(),
+			mcp.Description("Day to look up in YYYY-MM-DD format"),
+		),
+		mcp.WithString("timezone",
+			mcp.Description("IANA timezone the day is interpreted in (default: MEMORY_TIMEZONE or UTC)"),
+		),
+		mcp.WithString("dateField",
+			mcp.Description("Timestamp to match the day against (default: created_at)"),
+			mcp.Enum("created_at", "updated_at"),
+		),
+	)
+
+	addTool(onDateTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		date, ok := request.Params.Arguments["date"].(string)
+		if !ok {
+			return mcp.NewToolResultError("date must be a string"), nil
+		}
+
+		location := defaultLocation
+		if tz, ok := request.Params.Arguments["timezone"].(string); ok && tz != "" {
+			loc, err := time.LoadLocation(tz)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("invalid timezone: %v", err)), nil
+			}
+			location = loc
+		}
+
+		dateField := "created_at"
+		if f, ok := request.Params.Arguments["dateField"].(string); ok && f != "" {
+			if f != "created_at" && f != "updated_at" {
+				return mcp.NewToolResultError("dateField must be created_at or updated_at"), nil
+			}
+			dateField = f
+		}
+
+		start, end, err := dayRange(date, location)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+
+		type datedMemory struct {
+			result    chromem.Result
+			timestamp time.Time
+		}
+
+		var matches []datedMemory
+		for _, memory := range memories {
+			// Memories that were never updated count as updated when created
+			timestamp, ok := memoryCreatedAt(memory.ID, memory.Metadata)
+			if dateField == "updated_at" {
+				timestamp = memoryLastActive(memory.ID, memory.Metadata)
+			}
+			if !ok || timestamp.Before(start) || !timestamp.Before(end) {
+				continue
+			}
+			matches = append(matches, datedMemory{result: memory, timestamp: timestamp})
+		}
+
+		if len(matches) == 0 {
+			return mcp.NewToolResultText(fmt.Sprintf("No memories found on %s.", date)), nil
+		}
+
+		sort.Slice(matches, func(i, j int) bool {
+			return matches[i].timestamp.Before(matches[j].timestamp)
+		})
+
+		// Format results
+		entries := make([]string, 0, len(matches))
+		for i, match := range matches {
+			if resultTemplate != nil {
+				rendered, err := renderMemory(resultTemplate, newMemoryView(i+1, match.result, titleMode, timestampFormat{Layout: timestamps.Layout, Location: location}))
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				entries = append(entries, rendered)
+				continue
+			}
+
+			entry := fmt.Sprintf("[%d] %s (%s: %s)\n", i+1, memoryTitle(match.result.Content, titleMode), dateField, match.timestamp.In(location).Format(timestamps.Layout))
+			if titleMode != "" {
+				entry += fmt.Sprintf("   ID: %s\n", match.result.ID)
+			}
+			if metadata, ok := match.result.Metadata["raw_metadata"]; ok && metadata != "" {
+				entry += fmt.Sprintf("   Metadata: %s\n", metadata)
+			}
+			entries = append(entries, entry+"\n")
+		}
+
+		header := fmt.Sprintf("Found %d memories on %s (%s):\n\n", len(matches), date, location)
+		return mcp.NewToolResultText(fitEntries(header, entries, maxResponseBytes)), nil
+	})
+
+	// Add temporal neighbors tool
+	temporalNeighborsTool := mcp.NewTool("temporal_neighbors",
+		mcp.WithDescription("List the memories created just before and just after a given memory"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the memory to look around"),
+		),
+		mcp.WithNumber("count",
+			mcp.Description("Number of memories on each side (default: 3)"),
+			mcp.Min(1),
+			mcp.Max(50),
+		),
+	)
+
+	addTool(temporalNeighborsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, ok := request.Params.Arguments["id"].(string)
+		if !ok {
+			return mcp.NewToolResultError("id must be a string"), nil
+		}
+		count := 3
+		if c, ok := request.Params.Arguments["count"].(float64); ok {
+			count = int(c)
+		}
+		if count < 1 {
+			return mcp.NewToolResultError("count must be at least 1"), nil
+		}
+
+		if _, err := collection.GetByID(ctx, id); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("memory not found: %v", err)), nil
+		}
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+
+		type timedMemory struct {
+			result    chromem.Result
+			createdAt time.Time
+		}
+		timeline := make([]timedMemory, 0, len(memories))
+		for _, memory := range memories {
+			createdAt, _ := memoryCreatedAt(memory.ID, memory.Metadata)
+			timeline = append(timeline, timedMemory{memory, createdAt})
+		}
+		sort.Slice(timeline, func(i, j int) bool {
+			if !timeline[i].createdAt.Equal(timeline[j].createdAt) {
+				return timeline[i].createdAt.Before(timeline[j].createdAt)
+			}
+			return timeline[i].result.ID < timeline[j].result.ID
+		})
+
+		at := slices.IndexFunc(timeline, func(m timedMemory) bool { return m.result.ID == id })
+		if at < 0 {
+			return mcp.NewToolResultError(fmt.Sprintf("memory not found: %s", id)), nil
+		}
+		target := timeline[at]
+		before := timeline[max(0, at-count):at]
+		after := timeline[at+1 : min(len(timeline), at+1+count)]
+		if len(before) == 0 && len(after) == 0 {
+			return mcp.NewToolResultText(fmt.Sprintf("Memory %s has no other memories around it.", id)), nil
+		}
+
+		format := func(m timedMemory) string {
+			offset := m.createdAt.Sub(target.createdAt).Round(time.Second)
+			sign := "+"
+			if offset < 0 {
+				sign, offset = "-", -offset
+			}
+			return fmt.Sprintf("[%s%s] %s: %s\n", sign, offset, m.result.ID, memoryTitle(m.result.Content, titleMode))
+		}
+
+		response := fmt.Sprintf("Memories around %s (created %s):\n\n", id, timestamps.Format(target.createdAt))
+		for _, m := range before {
+			response += format(m)
+		}
+		response += fmt.Sprintf("[0s] %s: %s\n", id, memoryTitle(target.result.Content, titleMode))
+		for _, m := range after {
+			response += format(m)
+		}
+
+		return mcp.NewToolResultText(response), nil
+	})
+
+	// Add activity timeline tool
+	activityTool := mcp.NewTool("activity_timeline",
+		mcp.WithDescription("Count memories created per day, week or month over a date range, as a JSON series"),
+		mcp.WithString("granularity",
+			mcp.Description("Length of each period; weeks start on Monday (default: day)"),
+			mcp.Enum(activityGranularities...),
+		),
+		mcp.WithString("from",
+			mcp.Description("First day to include in YYYY-MM-DD format (default: the day of the oldest memory)"),
+		),
+		mcp.WithString("to",
+			mcp.Description("Last day to include in YYYY-MM-DD format (default: today)"),
+		),
+		mcp.WithString("timezone",
+			mcp.Description("IANA timezone periods are bucketed in (default: MEMORY_TIMEZONE or UTC)"),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent JSON output for readability (default: MEMORY_PRETTY_JSON)"),
+		),
+	)
+
+	addTool(activityTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		granularity := "day"
+		if g, ok := request.Params.Arguments["granularity"].(string); ok && g != "" {
+			if !slices.Contains(activityGranularities, g) {
+				return mcp.NewToolResultError(fmt.Sprintf("granularity must be one of %s", strings.Join(activityGranularities, ", "))), nil
+			}
+			granularity = g
+		}
+
+		location := defaultLocation
+		if tz, ok := request.Params.Arguments["timezone"].(string); ok && tz != "" {
+			loc, err := time.LoadLocation(tz)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("invalid timezone: %v", err)), nil
+			}
+			location = loc
+		}
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+
+		oldest := time.Now()
+		for _, memory := range memories {
+			if createdAt, ok := memoryCreatedAt(memory.ID, memory.Metadata); ok && createdAt.Before(oldest) {
+				oldest = createdAt
+			}
+		}
+
+		// The range covers whole days [from, to] in the requested timezone
+		from := periodStart(oldest.In(location), "day")
+		if f, ok := request.Params.Arguments["from"].(string); ok && f != "" {
+			if from, err = time.ParseInLocation("2006-01-02", f, location); err != nil {
+				return mcp.NewToolResultError("from must be in YYYY-MM-DD format"), nil
+			}
+		}
+		to := periodStart(time.Now().In(location), "day")
+		if t, ok := request.Params.Arguments["to"].(string); ok && t != "" {
+			if to, err = time.ParseInLocation("2006-01-02", t, location); err != nil {
+				return mcp.NewToolResultError("to must be in YYYY-MM-DD format"), nil
+			}
+		}
+		if to.Before(from) {
+			return mcp.NewToolResultError("to must not be before from"), nil
+		}
+
+		// Count each memory created in the range in the period it was
+		// created in. The first and last periods may extend past the range,
+		// but only its days are counted
+		end := to.AddDate(0, 0, 1)
+		counts := make(map[time.Time]int)
+		for _, memory := range memories {
+			createdAt, ok := memoryCreatedAt(memory.ID, memory.Metadata)
+			if !ok || createdAt.Before(from) || !createdAt.Before(end) {
+				continue
+			}
+			counts[periodStart(createdAt.In(location), granularity)]++
+		}
+
+		type period struct {
+			Period string `json:"period"`
+			Count  int    `json:"count"`
+		}
+		series := []period{}
+		for start := periodStart(from, granularity); !start.After(to); start = nextPeriod(start, granularity) {
+			if len(series) == maxActivityPeriods {
+				return mcp.NewToolResultError(fmt.Sprintf("range spans more than %d periods; narrow it or use a coarser granularity", maxActivityPeriods)), nil
+			}
+			series = append(series, period{Period: start.Format("2006-01-02"), Count: counts[start]})
+		}
+
+		data, err := marshalJSON(series, wantPretty(request.Params.Arguments))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to encode timeline: %v", err)), nil
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+
+	// Add feed tool
+	feedTool := mcp.NewTool("feed",
+		mcp.WithDescription("Publish the most recent memories as a JSON Feed or Atom document, newest first, for feed readers and automation"),
+		mcp.WithString("format",
+			mcp.Description("Feed document format (default: json)"),
+			mcp.Enum(feedFormats...),
+		),
+		mcp.WithString("type",
+			mcp.Description("Only include memories with this metadata type"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of entries per page (default: 20)"),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Number of newer entries to skip, as given by the feed's next link (default: 0)"),
+			mcp.Min(0),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent JSON output for readability (default: MEMORY_PRETTY_JSON)"),
+		),
+	)
+
+	addTool(feedTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		format := "json"
+		if f, ok := request.Params.Arguments["format"].(string); ok && f != "" {
+			if !slices.Contains(feedFormats, f) {
+				return mcp.NewToolResultError(fmt.Sprintf("format must be one of %s", strings.Join(feedFormats, ", "))), nil
+			}
+			format = f
+		}
+		typeFilter, _ := request.Params.Arguments["type"].(string)
+		typeFilter = synonyms.Canonical(typeFilter)
+
+		limit := 20
+		if l, ok := request.Params.Arguments["limit"].(float64); ok {
+			limit = int(l)
+		}
+		offset := 0
+		if o, ok := request.Params.Arguments["offset"].(float64); ok {
+			offset = int(o)
+		}
+		if limit < 1 || offset < 0 {
+			return mcp.NewToolResultError("limit must be at least 1 and offset not negative"), nil
+		}
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+		if typeFilter != "" {
+			memories = slices.DeleteFunc(memories, func(memory chromem.Result) bool {
+				return synonyms.Canonical(memoryType(memory.Metadata["raw_metadata"])) != typeFilter
+			})
+		}
+		sort.SliceStable(memories, func(i, j int) bool {
+			a, _ := memoryCreatedAt(memories[i].ID, memories[i].Metadata)
+			b, _ := memoryCreatedAt(memories[j].ID, memories[j].Metadata)
+			return a.After(b)
+		})
+
+		page := feedPage{Title: "Memories", Type: typeFilter, Limit: limit}
+		if typeFilter != "" {
+			page.Title = fmt.Sprintf("Memories of type %s", typeFilter)
+		}
+		page.Memories = memories[min(offset, len(memories)):]
+		if len(page.Memories) > limit {
+			page.Memories = page.Memories[:limit]
+			page.NextOffset = offset + limit
+		}
+
+		var document string
+		if format == "atom" {
+			document, err = page.atomFeed()
+		} else {
+			document, err = page.jsonFeed(wantPretty(request.Params.Arguments))
+		}
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText(document), nil
+	})
+
+	// Add latest memory tool
+	latestTool := mcp.NewTool("latest_id",
+		mcp.WithDescription("Return the most recently stored memory, for resuming incremental syncs"),
+	)
+
+	addTool(latestTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+
+		var latest *chromem.Result
+		var latestAt time.Time
+		for i, memory := range memories {
+			createdAt, ok := memoryCreatedAt(memory.ID, memory.Metadata)
+			if !ok {
+				continue
+			}
+			if latest == nil || createdAt.After(latestAt) || (createdAt.Equal(latestAt) && memory.ID > latest.ID) {
+				latest = &memories[i]
+				latestAt = createdAt
+			}
+		}
+
+		if latest == nil {
+			return mcp.NewToolResultText("No memories stored yet."), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("Latest memory ID: %s (created: %s)\n%s",
+			latest.ID, timestamps.Format(latestAt), latest.Content)), nil
+	})
+
+	// Add type listing tool
+	listTypesTool := mcp.NewTool("list_types",
+		mcp.WithDescription("List the distinct memory types found in metadata, with counts"),
+	)
+
+	addTool(listTypesTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		counts, err := typeCounts(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list types: %v", err)), nil
+		}
+
+		for _, t := range knownTypes {
+			if _, ok := counts[t]; !ok {
+				counts[t] = 0
+			}
+		}
+
+		types := make([]string, 0, len(counts))
+		for t := range counts {
+			types = append(types, t)
+		}
+		sort.Slice(types, func(i, j int) bool {
+			if counts[types[i]] != counts[types[j]] {
+				return counts[types[i]] > counts[types[j]]
+			}
+			return types[i] < types[j]
+		})
+
+		response := fmt.Sprintf("Found %d memory types:\n\n", len(types))
+		for _, t := range types {
+			response += fmt.Sprintf("- %s: %d\n", t, counts[t])
+		}
+
+		return mcp.NewToolResultText(response), nil
+	})
+
+	// Add grouped type listing tool
+	byTypesTool := mcp.NewTool("by_types",
+		mcp.WithDescription("List the memories of several types in one call, grouped by type with per-type counts, as JSON"),
+		mcp.WithArray("types",
+			mcp.Required(),
+			mcp.Description("Metadata types to group memories by; a memory has one type, so groups never overlap"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of memories per type, newest first (default: 10)"),
+			mcp.Min(1),
+			mcp.Max(100),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Number of memories to skip in each type, for paging (default: 0)"),
+			mcp.Min(0),
+		),
+		mcp.WithArray("fields",
+			mcp.Description("Only include these fields of each memory: "+strings.Join(projectionFields, ", ")),
+			mcp.Items(map[string]any{"type": "string", "enum": projectionFields}),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent JSON output for readability (default: MEMORY_PRETTY_JSON)"),
+		),
+	)
+
+	addTool(byTypesTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		raw, ok := request.Params.Arguments["types"].([]any)
+		if !ok || len(raw) == 0 {
+			return mcp.NewToolResultError("types must be a non-empty array of strings"), nil
+		}
+		limit := 10
+		if l, ok := request.Params.Arguments["limit"].(float64); ok {
+			limit = int(l)
+		}
+		offset := 0
+		if o, ok := request.Params.Arguments["offset"].(float64); ok {
+			offset = int(o)
+		}
+		if limit < 1 || offset < 0 {
+			return mcp.NewToolResultError("limit must be at least 1 and offset not negative"), nil
+		}
+
+		fields, err := parseFields(request.Params.Arguments)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if len(fields) == 0 {
+			fields = slices.DeleteFunc(slices.Clone(projectionFields), func(f string) bool { return f == "similarity" })
+		}
+
+		groups := make(map[string][]chromem.Result, len(raw))
+		for _, r := range raw {
+			t, ok := r.(string)
+			if !ok {
+				return mcp.NewToolResultError(fmt.Sprintf("invalid type %v: types must be strings", r)), nil
+			}
+			groups[synonyms.Canonical(t)] = nil
+		}
+
+		// One scan serves every requested type
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+		for _, memory := range memories {
+			t := synonyms.Canonical(memoryType(memory.Metadata["raw_metadata"]))
+			if group, ok := groups[t]; ok {
+				groups[t] = append(group, memory)
+			}
+		}
+
+		type typeGroup struct {
+			Count    int              `json:"count"`
+			Memories []map[string]any `json:"memories"`
+		}
+		output := make(map[string]typeGroup, len(groups))
+		for t, group := range groups {
+			sort.Slice(group, func(i, j int) bool {
+				ti, _ := memoryCreatedAt(group[i].ID, group[i].Metadata)
+				tj, _ := memoryCreatedAt(group[j].ID, group[j].Metadata)
+				if !ti.Equal(tj) {
+					return ti.After(tj)
+				}
+				return group[i].ID < group[j].ID
+			})
+
+			page := group[min(offset, len(group)):]
+			page = page[:min(limit, len(page))]
+			projected := make([]map[string]any, 0, len(page))
+			for _, memory := range page {
+				projected = append(projected, projectMemory(memory, fields))
+			}
+			output[t] = typeGroup{Count: len(group), Memories: projected}
+		}
+
+		data, err := marshalJSON(output, wantPretty(request.Params.Arguments))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to encode memories: %v", err)), nil
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+
+	// Add change feed tool
+	changesSinceTool := mcp.NewTool("changes_since",
+		mcp.WithDescription("List store mutations after a change sequence number, oldest first. Deletes older than MEMORY_TOMBSTONE_TTL are dropped, so a replica that hasn't synced within it must start over from export_memories"),
+		mcp.WithNumber("seq",
+			mcp.Description("Return changes with a sequence number greater than this (default: 0)"),
+			mcp.Min(0),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of changes (default: 100)"),
+			mcp.Min(1),
+			mcp.Max(1000),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent JSON output for readability (default: MEMORY_PRETTY_JSON)"),
+		),
+	)
+
+	addTool(changesSinceTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var seq uint64
+		if sq, ok := request.Params.Arguments["seq"].(float64); ok && sq > 0 {
+			seq = uint64(sq)
+		}
+
+		limit := 100
+		if l, ok := request.Params.Arguments["limit"].(float64); ok {
+			limit = int(l)
+		}
+
+		since, err := changes.Since(seq, limit)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to read changes: %v", err)), nil
+		}
+		if since == nil {
+			since = []Change{}
+		}
+
+		data, err := marshalJSON(since, wantPretty(request.Params.Arguments))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to encode changes: %v", err)), nil
+		}
+
+		return mcp.NewToolResultText(string(data)), nil
+	})
 
-	// Create OpenAI client for embeddings
-	client := openai.NewClient(openAIKey)
+	// Add near-duplicate detection tool
+	findDuplicatesTool := mcp.NewTool("find_duplicates",
+		mcp.WithDescription("List clusters of near-duplicate memories of the same type for review"),
+		mcp.WithNumber("threshold",
+			mcp.Description("Minimum embedding similarity for two memories to count as duplicates (default: 0.95)"),
+			mcp.Min(0),
+			mcp.Max(1),
+		),
+		mcp.WithNumber("maxCandidates",
+			mcp.Description("Maximum number of most recent memories to compare (default: 2000)"),
+			mcp.Min(2),
+			mcp.Max(10000),
+		),
+	)
 
-	return &MemoryServer{
-		db:       db,
-		aiClient: client,
-	}, nil
-}
+	addTool(findDuplicatesTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		threshold := float32(0.95)
+		if t, ok := request.Params.Arguments["threshold"].(float64); ok {
+			threshold = float32(t)
+		}
 
-func (ms *MemoryServer) generateEmbedding(text string) ([]float32, error) {
-	queryReq := openai.EmbeddingRequest{
-		Input: []string{text},
-		Model: openai.AdaEmbeddingV2,
-	}
+		maxCandidates := 2000
+		if m, ok := request.Params.Arguments["maxCandidates"].(float64); ok {
+			maxCandidates = int(m)
+		}
 
-	queryResponse, err := ms.aiClient.CreateEmbeddings(context.Background(), queryReq)
-	if err != nil {
-		return nil, fmt.Errorf("error creating embedding: %w", err)
-	}
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
 
-	// Convert float64 to float32
-	embedding := queryResponse.Data[0].Embedding
-	result := make([]float32, len(embedding))
-	for i, v := range embedding {
-		result[i] = float32(v)
-	}
+		// Comparison is quadratic, so only look at the most recent memories
+		if len(memories) > maxCandidates {
+			sort.Slice(memories, func(i, j int) bool { return memories[i].ID > memories[j].ID })
+			memories = memories[:maxCandidates]
+		}
 
-	return result, nil
-}
+		clusters := nearDuplicateClusters(memories, threshold)
+		if len(clusters) == 0 {
+			return mcp.NewToolResultText("No near-duplicate memories found."), nil
+		}
 
-func main() {
-	// Get environment variables
-	dbPath := os.Getenv("MEMORY_DB_PATH")
-	if dbPath == "" {
-		dbPath = "./memory"
-	}
+		response := fmt.Sprintf("Found %d clusters of near-duplicate memories:\n\n", len(clusters))
+		for i, cluster := range clusters {
+			response += fmt.Sprintf("Cluster %d:\n", i+1)
+			for _, memory := range cluster {
+				response += fmt.Sprintf("- %s: %s\n", memory.ID, memory.Content)
+			}
+			response += "\n"
+		}
 
-	openAIKey := os.Getenv("OPENAI_API_KEY")
-	if openAIKey == "" {
-		log.Fatal("OPENAI_API_KEY environment variable required")
-	}
+		return mcp.NewToolResultText(response), nil
+	})
 
-	// Create memory server
-	memServer, err := NewMemoryServer(dbPath, openAIKey)
-	if err != nil {
-		log.Fatalf("Failed to create memory server: %v", err)
-	}
+	// Add integrity check tool
+	checkIntegrityTool := mcp.NewTool("check_integrity",
+		mcp.WithDescription("Check the store for inconsistencies without changing anything, reporting counts of each problem as JSON"),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent JSON output for readability (default: MEMORY_PRETTY_JSON)"),
+		),
+	)
 
-	// Create MCP server
-	s := server.NewMCPServer(
-		"ChromeDB Memory Server",
-		"1.0.0",
-		server.WithResourceCapabilities(true, true),
-		server.WithLogging(),
+	addTool(checkIntegrityTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		report := checkIntegrity(ctx, collection, schemaPath, memServer.currentSchema(), changes)
+
+		data, err := marshalJSON(report, wantPretty(request.Params.Arguments))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to encode report: %v", err)), nil
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+
+	// Add autocomplete tool
+	suggestTool := mcp.NewTool("suggest",
+		mcp.WithDescription("Suggest completions for a partially typed phrase from stored memory content"),
+		mcp.WithString("prefix",
+			mcp.Required(),
+			mcp.Description("Partial phrase to complete, e.g. \"mach\""),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of suggestions (default: 5)"),
+			mcp.Min(1),
+			mcp.Max(20),
+		),
 	)
 
-	// Get or create collection
-	collection, err := memServer.db.GetOrCreateCollection("memories", nil, nil)
-	if err != nil {
-		log.Fatalf("Failed to get/create collection: %v", err)
-	}
+	addTool(suggestTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		prefix, ok := request.Params.Arguments["prefix"].(string)
+		if !ok {
+			return mcp.NewToolResultError("prefix must be a string"), nil
+		}
 
-	// Add memory storage tool
-	addMemoryTool := mcp.NewTool("add_memory",
-		mcp.WithDescription("Store text in ChromeDB with vector embeddings for semantic search"),
-		mcp.WithString("content",
+		limit := 5
+		if l, ok := request.Params.Arguments["limit"].(float64); ok {
+			limit = int(l)
+		}
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+
+		contents := make([]string, 0, len(memories))
+		for _, memory := range memories {
+			contents = append(contents, memory.Content)
+		}
+
+		suggestions := suggestCompletions(contents, prefix, limit)
+		if len(suggestions) == 0 {
+			return mcp.NewToolResultText("No suggestions found."), nil
+		}
+
+		return mcp.NewToolResultText(strings.Join(suggestions, "\n")), nil
+	})
+
+	// Add export tool
+	exportTool := mcp.NewTool("export_memories",
+		mcp.WithDescription("Export all memories as a JSON array, including their embeddings"),
+		mcp.WithBoolean("compressed",
+			mcp.Description("Return the JSON gzipped and base64 encoded (default: false)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of memories to export, oldest first"),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Number of memories to skip, for paging (default: 0)"),
+			mcp.Min(0),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent JSON output for readability (default: MEMORY_PRETTY_JSON)"),
+		),
+	)
+
+	addTool(exportTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		compressed, _ := request.Params.Arguments["compressed"].(bool)
+
+		limit := 0
+		if l, ok := request.Params.Arguments["limit"].(float64); ok {
+			limit = int(l)
+		}
+		offset := 0
+		if o, ok := request.Params.Arguments["offset"].(float64); ok {
+			offset = int(o)
+		}
+
+		total := collection.Count()
+		if limit > exportMax {
+			return mcp.NewToolResultError(fmt.Sprintf("limit %d exceeds the export maximum of %d", limit, exportMax)), nil
+		}
+		if limit == 0 && total-offset > exportMax {
+			return mcp.NewToolResultError(fmt.Sprintf("store holds %d memories, more than the export maximum of %d; "+
+				"page through them with limit and offset", total, exportMax)), nil
+		}
+
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+
+		exported := exportMemories(memories)
+		exported = exported[min(offset, len(exported)):]
+		if limit > 0 && len(exported) > limit {
+			exported = exported[:limit]
+		}
+
+		// The payload must stay importable, so a note about memories that
+		// didn't fit goes in a separate content item
+		payload, fitted, err := fitResponse(len(exported), maxResponseBytes, func(k int) (string, error) {
+			return encodeExport(exported[:k], compressed, wantPretty(request.Params.Arguments))
+		})
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if fitted == 0 && len(exported) > 0 {
+			return mcp.NewToolResultError(fmt.Sprintf("a single memory exceeds the %d byte response limit; raise MEMORY_MAX_RESPONSE_BYTES", maxResponseBytes)), nil
+		}
+
+		result := mcp.NewToolResultText(payload)
+		if fitted < len(exported) {
+			result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf(
+				"Only %d of %d memories fit in the %d byte response limit; continue with offset %d.", fitted, len(exported), maxResponseBytes, offset+fitted)))
+		}
+		return result, nil
+	})
+
+	// Add import tool
+	importTool := mcp.NewTool("import_memories",
+		mcp.WithDescription("Import memories from the output of export_memories"),
+		mcp.WithString("data",
 			mcp.Required(),
-			mcp.Description("Text content to store in the database"),
+			mcp.Description("JSON array of memories or an export_subgraph bundle, or its gzipped base64 form"),
 		),
-		mcp.WithString("metadata",
-			mcp.Description("Optional JSON metadata for categorization"),
+		mcp.WithBoolean("compressed",
+			mcp.Description("Whether data is gzipped and base64 encoded (default: false)"),
 		),
 	)
 
-	s.AddTool(addMemoryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		content, ok := request.Params.Arguments["content"].(string)
+	addTool(importTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		data, ok := request.Params.Arguments["data"].(string)
 		if !ok {
-			return mcp.NewToolResultError("content must be a string"), nil
+			return mcp.NewToolResultError("data must be a string"), nil
+		}
+		compressed, _ := request.Params.Arguments["compressed"].(bool)
+
+		memories, err := decodeImport(data, compressed)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		imported := 0
+		for _, memory := range memories {
+			if normalizeContent(memory.Content, collapseWhitespace) == "" {
+				continue
+			}
+
+			// Imported memories pass the same checks as new ones
+			content, metadata, err := validateMemory(ctx, memory.Content, memory.Metadata["raw_metadata"], memoryImportance(memory.Metadata))
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("imported %d memories, then %s: %v", imported, memory.ID, err)), nil
+			}
+			if content != memory.Content || metadata != memory.Metadata["raw_metadata"] {
+				// The exported embedding was made from what validation
+				// changed, e.g. a redacted secret
+				memory.Embedding = nil
+			}
+
+			now := time.Now()
+			doc := chromem.Document{
+				ID:        memory.ID,
+				Metadata:  maps.Clone(memory.Metadata),
+				Embedding: memory.Embedding,
+				Content:   content,
+			}
+			if doc.ID == "" {
+				doc.ID = fmt.Sprintf("mem_%d", now.UnixNano())
+			}
+			if doc.Metadata == nil {
+				doc.Metadata = map[string]string{}
+			}
+			if metadata != "" {
+				doc.Metadata["raw_metadata"] = metadata
+			}
+			if _, ok := doc.Metadata["created_at"]; !ok {
+				createdAt, ok := memoryCreatedAt(doc.ID, nil)
+				if !ok {
+					createdAt = now
+				}
+				doc.Metadata["created_at"] = createdAt.UTC().Format(time.RFC3339Nano)
+			}
+			if len(doc.Embedding) != embeddingDimensions {
+				doc.Embedding, err = memServer.embedMemory(ctx, doc.Content, doc.Metadata["raw_metadata"])
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("imported %d memories, then failed to generate embedding for %s: %v", imported, doc.ID, err)), nil
+				}
+			}
+
+			if err := putDocument(ctx, collection, doc); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("imported %d memories, then failed to add %s: %v", imported, doc.ID, err)), nil
+			}
+			if err := recordChange("add", doc.ID, doc.Content); err != nil {
+				collection.Delete(ctx, nil, nil, doc.ID)
+				return mcp.NewToolResultError(fmt.Sprintf("imported %d memories, then failed to record change: %v", imported, err)), nil
+			}
+			imported++
+		}
+
+		enforceLimits(ctx)
+
+		return mcp.NewToolResultText(fmt.Sprintf("Imported %d memories", imported)), nil
+	})
+
+	// Add plain text import tool
+	importTextTool := mcp.NewTool("import_text",
+		mcp.WithDescription("Create one memory per line, paragraph or delimited chunk of plain text, e.g. to load existing notes"),
+		mcp.WithString("text",
+			mcp.Required(),
+			mcp.Description("Text to import"),
+		),
+		mcp.WithString("splitBy",
+			mcp.Description("Cut the text at each line break, at blank lines between paragraphs, or at each occurrence of delimiter (default: paragraph)"),
+			mcp.Enum(textSplitModes...),
+		),
+		mcp.WithString("delimiter",
+			mcp.Description("Text separating chunks when splitBy is delimiter, e.g. \"---\""),
+		),
+		mcp.WithString("type",
+			mcp.Description("Metadata type to give every imported memory (default: MEMORY_DEFAULT_TYPE)"),
+		),
+		mcp.WithNumber("importance",
+			mcp.Description("Importance from 1 (trivial) to 5 (critical) for every imported memory (default: 3)"),
+			mcp.Min(minImportance),
+			mcp.Max(maxImportance),
+		),
+	)
+
+	addTool(importTextTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		text, ok := request.Params.Arguments["text"].(string)
+		if !ok {
+			return mcp.NewToolResultError("text must be a string"), nil
+		}
+		splitBy := "paragraph"
+		if mode, ok := request.Params.Arguments["splitBy"].(string); ok && mode != "" {
+			if !slices.Contains(textSplitModes, mode) {
+				return mcp.NewToolResultError(fmt.Sprintf("splitBy must be one of %s", strings.Join(textSplitModes, ", "))), nil
+			}
+			splitBy = mode
+		}
+		delimiter, _ := request.Params.Arguments["delimiter"].(string)
+		if splitBy == "delimiter" && delimiter == "" {
+			return mcp.NewToolResultError("delimiter must be a non-empty string when splitBy is delimiter"), nil
 		}
 
 		metadata := ""
-		if m, ok := request.Params.Arguments["metadata"].(string); ok {
-			metadata = m
+		if t, ok := request.Params.Arguments["type"].(string); ok && t != "" {
+			var err error
+			if metadata, err = withType("", t); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
 		}
 
-		// Generate embedding
-		embedding, err := memServer.generateEmbedding(content)
+		importance := defaultImportance
+		if i, ok := request.Params.Arguments["importance"].(float64); ok {
+			importance = int(i)
+		}
+
+		chunks := splitText(text, splitBy, delimiter)
+		if len(chunks) == 0 {
+			return mcp.NewToolResultText("No non-empty chunks to import."), nil
+		}
+		if len(chunks) > maxImportChunks {
+			return mcp.NewToolResultError(fmt.Sprintf("text splits into %d chunks, more than the %d one call may import; split the text", len(chunks), maxImportChunks)), nil
+		}
+
+		// Evicting for each chunk would list the store every time, so the
+		// limits are enforced once the whole text is in
+		ids := make([]string, 0, len(chunks))
+		for _, chunk := range chunks {
+			doc, err := insertMemory(ctx, chunk, metadata, importance, nil, "")
+			if err != nil {
+				enforceLimits(ctx)
+				return mcp.NewToolResultError(fmt.Sprintf("imported %d memories (%s), then: %v", len(ids), strings.Join(ids, ", "), err)), nil
+			}
+			ids = append(ids, doc.ID)
+		}
+		enforceLimits(ctx)
+
+		return mcp.NewToolResultText(fmt.Sprintf("Imported %d memories:\n%s", len(ids), strings.Join(ids, "\n"))), nil
+	})
+
+	// Add checkpoint tools
+	createCheckpointTool := mcp.NewTool("create_checkpoint",
+		mcp.WithDescription("Save a named snapshot of all memories that the store can later be rolled back to, e.g. before a bulk edit"),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the checkpoint, using letters, digits, '.', '_' or '-'"),
+		),
+	)
+
+	addTool(createCheckpointTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, ok := request.Params.Arguments["name"].(string)
+		if !ok {
+			return mcp.NewToolResultError("name must be a string"), nil
+		}
+		path, err := checkpointPath(checkpointDir, name)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("failed to generate embedding: %v", err)), nil
+			return mcp.NewToolResultError(err.Error()), nil
 		}
 
-		// Create document
-		doc := chromem.Document{
-			ID:        fmt.Sprintf("mem_%d", time.Now().UnixNano()),
-			Metadata:  map[string]string{"raw_metadata": metadata},
-			Embedding: embedding,
-			Content:   content,
+		if err := createCheckpoint(ctx, memServer.db, collectionName, path); err != nil {
+			return mcp.NewToolResultError(storageError(err).Error()), nil
 		}
 
-		// Add to collection
-		err = collection.AddDocument(ctx, doc)
+		return mcp.NewToolResultText(fmt.Sprintf("Checkpoint %s saved with %d memories.", name, collection.Count())), nil
+	})
+
+	listCheckpointsTool := mcp.NewTool("list_checkpoints",
+		mcp.WithDescription("List the saved checkpoints, newest first"),
+	)
+
+	addTool(listCheckpointsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		checkpoints, err := listCheckpoints(checkpointDir)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("failed to add document: %v", err)), nil
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list checkpoints: %v", err)), nil
+		}
+		if len(checkpoints) == 0 {
+			return mcp.NewToolResultText("No checkpoints found."), nil
 		}
 
-		return mcp.NewToolResultText(fmt.Sprintf("Memory stored with ID: %s", doc.ID)), nil
+		response := fmt.Sprintf("Found %d checkpoints:\n\n", len(checkpoints))
+		for _, cp := range checkpoints {
+			response += fmt.Sprintf("- %s (created %s, %d bytes)\n", cp.Name, timestamps.Format(cp.CreatedAt), cp.Size)
+		}
+
+		return mcp.NewToolResultText(response), nil
 	})
 
-	// Add semantic search tool
-	searchTool := mcp.NewTool("search_memory",
-		mcp.WithDescription("Search ChromeDB for semantically similar content"),
-		mcp.WithString("query",
+	restoreCheckpointTool := mcp.NewTool("restore_checkpoint",
+		mcp.WithDescription("Roll all memories back to a checkpoint, discarding every change made since. Without confirm it only describes what would change"),
+		mcp.WithString("name",
 			mcp.Required(),
-			mcp.Description("Search query to find similar memories"),
+			mcp.Description("Name of the checkpoint to restore"),
 		),
-		mcp.WithNumber("limit",
-			mcp.Description("Maximum number of results (default: 5)"),
-			mcp.Min(1),
-			mcp.Max(20),
+		mcp.WithBoolean("confirm",
+			mcp.Description("Actually restore; memories added since the checkpoint are deleted (default: false)"),
 		),
 	)
 
-	s.AddTool(searchTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		query, ok := request.Params.Arguments["query"].(string)
+	addTool(restoreCheckpointTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, ok := request.Params.Arguments["name"].(string)
 		if !ok {
-			return mcp.NewToolResultError("query must be a string"), nil
+			return mcp.NewToolResultError("name must be a string"), nil
 		}
-
-		limit := 5
-		if l, ok := request.Params.Arguments["limit"].(float64); ok {
-			limit = int(l)
+		confirm, _ := request.Params.Arguments["confirm"].(bool)
+		path, err := checkpointPath(checkpointDir, name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if _, err := os.Stat(path); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("checkpoint %s not found; use list_checkpoints to see saved ones", name)), nil
 		}
 
-		// Generate query embedding
-		queryEmbedding, err := memServer.generateEmbedding(query)
+		saved, err := loadCheckpoint(ctx, collectionName, path)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		current, err := listMemories(ctx, collection)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("failed to generate query embedding: %v", err)), nil
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+
+		diff := diffCheckpoint(saved, current)
+
+		if !confirm {
+			return mcp.NewToolResultText(fmt.Sprintf("Restoring %s would delete %d memories added since it was taken, add back %d deleted ones and revert %d changed ones, "+
+				"returning the store to its %d saved memories. Call again with confirm: true to proceed.", name, len(diff.Added), len(diff.Deleted), len(diff.Modified), len(saved))), nil
+		}
+
+		for i, id := range diff.Added {
+			if err := collection.Delete(ctx, nil, nil, id); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("deleted %d of %d newer memories, then: %v", i, len(diff.Added), err)), nil
+			}
+			if err := recordChange("delete", id, ""); err != nil {
+				log.Printf("Failed to record deletion of %s: %v", id, err)
+			}
+		}
+		// Only memories that differ are written, so unchanged ones don't
+		// show up in the change log
+		for i, memory := range diff.Deleted {
+			doc := chromem.Document{ID: memory.ID, Metadata: memory.Metadata, Embedding: memory.Embedding, Content: memory.Content}
+			if err := putDocument(ctx, collection, doc); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("added back %d of %d deleted memories, then: %v", i, len(diff.Deleted), err)), nil
+			}
+			if err := recordChange("add", doc.ID, doc.Content); err != nil {
+				log.Printf("Failed to record restore of %s: %v", doc.ID, err)
+			}
+		}
+		// Reverted memories move on to a new version rather than back to the
+		// saved one, so clients holding the version they changed see a conflict
+		currentByID := make(map[string]chromem.Result, len(current))
+		for _, memory := range current {
+			currentByID[memory.ID] = memory
+		}
+		for i, memory := range diff.Modified {
+			now := currentByID[memory.ID]
+			previous := chromem.Document{ID: now.ID, Metadata: now.Metadata, Embedding: now.Embedding, Content: now.Content}
+			reverted := chromem.Document{ID: memory.ID, Metadata: memory.Metadata, Embedding: memory.Embedding, Content: memory.Content}
+			if err := saveUpdate(ctx, collection, recordChange, previous, reverted); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("reverted %d of %d changed memories, then: %v", i, len(diff.Modified), err)), nil
+			}
 		}
 
-		// Search for similar documents
-		results, err := collection.QueryEmbedding(ctx, queryEmbedding, limit, nil, nil)
+		return mcp.NewToolResultText(fmt.Sprintf("Restored checkpoint %s: %d newer memories deleted, %d added back, %d reverted.", name, len(diff.Added), len(diff.Deleted), len(diff.Modified))), nil
+	})
+
+	// Add random memory tool
+	randomTool := mcp.NewTool("random_memory",
+		mcp.WithDescription("Return a uniformly random memory, to resurface something forgotten"),
+		mcp.WithString("type",
+			mcp.Description("Only pick among memories with this metadata type"),
+		),
+	)
+
+	addTool(randomTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		memoryTypeFilter, _ := request.Params.Arguments["type"].(string)
+		memoryTypeFilter = synonyms.Canonical(memoryTypeFilter)
+
+		memories, err := listMemories(ctx, collection)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("search failed: %v", err)), nil
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list memories: %v", err)), nil
+		}
+
+		if memoryTypeFilter != "" {
+			filtered := memories[:0]
+			for _, memory := range memories {
+				if synonyms.Canonical(memoryType(memory.Metadata["raw_metadata"])) == memoryTypeFilter {
+					filtered = append(filtered, memory)
+				}
+			}
+			memories = filtered
 		}
 
-		if len(results) == 0 {
+		if len(memories) == 0 {
 			return mcp.NewToolResultText("No matching memories found."), nil
 		}
 
-		// Format results
-		response := fmt.Sprintf("Found %d relevant memories:\n\n", len(results))
-		for i, result := range results {
-			response += fmt.Sprintf("[%d] %s (similarity: %.3f)\n", i+1, result.Content, result.Similarity)
-			if metadata, ok := result.Metadata["raw_metadata"]; ok && metadata != "" {
-				response += fmt.Sprintf("   Metadata: %s\n", metadata)
-			}
-			response += "\n"
+		memory := memories[rand.IntN(len(memories))]
+		response := fmt.Sprintf("[%s] %s\n", memory.ID, memory.Content)
+		if metadata, ok := memory.Metadata["raw_metadata"]; ok && metadata != "" {
+			response += fmt.Sprintf("   Metadata: %s\n", metadata)
 		}
 
 		return mcp.NewToolResultText(response), nil
@@ -196,19 +4612,47 @@ func main() {
 	)
 
 	s.AddResource(statsResource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
-		count := collection.Count()
+		memories, err := listMemories(ctx, collection)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list memories: %w", err)
+		}
 
-		stats := fmt.Sprintf(`{
-  "total_memories": %d,
-  "database_path": "%s",
-  "collection_name": "memories"
-}`, count, dbPath)
+		// Distributions help pick MEMORY_MAX_BYTES and similar limits.
+		// Memories carry one type rather than a list of tags, so links stand
+		// in for a per-memory count and types are counted across the store
+		contentLengths := newHistogram(contentLengthBuckets)
+		linkCounts := newHistogram(linkCountBuckets)
+		typeCounts := make(map[string]int)
+		for _, memory := range memories {
+			contentLengths.Observe(len(memory.Content))
+			linkCounts.Observe(len(memoryLinks(memory.Metadata)))
+			typeCounts[synonyms.Canonical(memoryType(memory.Metadata["raw_metadata"]))]++
+		}
+
+		stats, err := marshalJSON(struct {
+			TotalMemories  int               `json:"total_memories"`
+			DatabasePath   string            `json:"database_path"`
+			CollectionName string            `json:"collection_name"`
+			ContentBytes   []histogramBucket `json:"content_bytes_histogram"`
+			LinkCounts     []histogramBucket `json:"link_count_histogram"`
+			TypeCounts     map[string]int    `json:"type_counts"`
+		}{
+			TotalMemories:  len(memories),
+			DatabasePath:   dbPath,
+			CollectionName: collectionName,
+			ContentBytes:   contentLengths.Buckets(),
+			LinkCounts:     linkCounts.Buckets(),
+			TypeCounts:     typeCounts,
+		}, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode stats: %w", err)
+		}
 
 		return []mcp.ResourceContents{
 			mcp.TextResourceContents{
 				URI:      "memory://stats",
 				MIMEType: "application/json",
-				Text:     stats,
+				Text:     string(stats),
 			},
 		}, nil
 	})
@@ -246,6 +4690,18 @@ search_memory(
   limit: 3
 )
 
+HOW TO REVIEW A DAY:
+Use the memories_on_date tool with these parameters:
+- date: The day in YYYY-MM-DD format (required)
+- timezone: IANA timezone name (optional, default: UTC)
+- dateField: created_at or updated_at (optional, default: created_at)
+
+Example:
+memories_on_date(
+  date: "2024-01-15",
+  timezone: "Europe/Paris"
+)
+
 TIPS FOR EFFECTIVE USE:
 1. Be specific when storing information
 2. Add metadata to help with organization
@@ -261,8 +4717,5 @@ TIPS FOR EFFECTIVE USE:
 		}, nil
 	})
 
-	// Start the server
-	if err := server.ServeStdio(s); err != nil {
-		fmt.Printf("Server error: %v\n", err)
-	}
+	return s, stop
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const redactedPlaceholder = "[REDACTED]"
+
+// secretPattern matches one kind of secret. Generic patterns also need a
+// check to tell random tokens apart from ordinary long words.
+type secretPattern struct {
+	re    *regexp.Regexp
+	check func(match string) bool
+}
+
+// defaultSecretPatterns cover common credential formats. Hex strings must be
+// longer than a SHA-1 so commit hashes in notes survive.
+var defaultSecretPatterns = []secretPattern{
+	{re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+	{re: regexp.MustCompile(`\b(?:sk|ghp|gho|ghs|ghu|github_pat|xox[abpr])[-_][A-Za-z0-9_-]{20,}`)},
+	{re: regexp.MustCompile(`\b[0-9a-fA-F]{48,}\b`)},
+	{re: regexp.MustCompile(`[A-Za-z0-9+/_-]{40,}={0,2}`), check: looksRandom},
+}
+
+// looksRandom reports whether a token mixes upper case letters, lower case
+// letters and digits, as encoded keys do and paths or identifiers rarely do.
+func looksRandom(token string) bool {
+	var upper, lower, digit bool
+	for _, r := range token {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+// redactor replaces secrets in memory content before it is stored or
+// embedded. A nil *redactor leaves content unchanged.
+type redactor struct {
+	patterns []secretPattern
+}
+
+// newRedactor creates a redactor using the default patterns plus any read
+// from patternsPath, one regular expression per line. Blank lines and lines
+// starting with # are skipped.
+func newRedactor(patternsPath string) (*redactor, error) {
+	r := &redactor{patterns: defaultSecretPatterns}
+	if patternsPath == "" {
+		return r, nil
+	}
+
+	f, err := os.Open(patternsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		re, err := regexp.Compile(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		r.patterns = append(r.patterns, secretPattern{re: re})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Redact replaces every secret in content with [REDACTED], returning the
+// result and the number of secrets replaced.
+func (r *redactor) Redact(content string) (string, int) {
+	if r == nil {
+		return content, 0
+	}
+
+	redacted := 0
+	for _, pattern := range r.patterns {
+		content = pattern.re.ReplaceAllStringFunc(content, func(match string) string {
+			if match == redactedPlaceholder || (pattern.check != nil && !pattern.check(match)) {
+				return match
+			}
+			redacted++
+			return redactedPlaceholder
+		})
+	}
+	return content, redacted
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// parseRetention parses per-type retention policies written as
+// "type=duration" pairs separated by commas, e.g. "conversation=72h,scratch=24h".
+func parseRetention(spec string) (map[string]time.Duration, error) {
+	policies := make(map[string]time.Duration)
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		t, d, ok := strings.Cut(pair, "=")
+		t = strings.TrimSpace(t)
+		if !ok || t == "" {
+			return nil, fmt.Errorf("%q is not of the form type=duration", pair)
+		}
+		retention, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || retention <= 0 {
+			return nil, fmt.Errorf("retention for %q must be a positive duration such as 72h", t)
+		}
+		policies[t] = retention
+	}
+	return policies, nil
+}
+
+// retentionCandidates returns the IDs of memories created longer ago than
+// the retention of their type, grouped by type. canonical maps stored types
+// to the names policies use. Memories whose type has no policy are kept, as
+// are pinned memories of maximum importance.
+func retentionCandidates(memories []chromem.Result, policies map[string]time.Duration, canonical func(string) string, now time.Time) map[string][]string {
+	expired := make(map[string][]string)
+	for _, memory := range memories {
+		t := canonical(memoryType(memory.Metadata["raw_metadata"]))
+		retention, ok := policies[t]
+		if !ok || memoryImportance(memory.Metadata) == maxImportance {
+			continue
+		}
+		createdAt, ok := memoryCreatedAt(memory.ID, memory.Metadata)
+		if ok && now.Sub(createdAt) > retention {
+			expired[t] = append(expired[t], memory.ID)
+		}
+	}
+	for _, ids := range expired {
+		sort.Strings(ids)
+	}
+	return expired
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+)
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[string]time.Duration
+		wantErr bool
+	}{
+		{spec: "conversation=72h", want: map[string]time.Duration{"conversation": 72 * time.Hour}},
+		{spec: " conversation = 72h , scratch=30m,", want: map[string]time.Duration{"conversation": 72 * time.Hour, "scratch": 30 * time.Minute}},
+		{spec: "", want: map[string]time.Duration{}},
+		{spec: "conversation", wantErr: true},
+		{spec: "=72h", wantErr: true},
+		{spec: "conversation=soon", wantErr: true},
+		{spec: "conversation=-1h", wantErr: true},
+		{spec: "conversation=0s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRetention(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRetention(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !maps.Equal(got, tt.want) {
+			t.Errorf("parseRetention(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestRetentionCandidates(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	memory := func(id, rawMetadata string, age time.Duration, importance string) chromem.Result {
+		metadata := map[string]string{
+			"raw_metadata": rawMetadata,
+			"created_at":   now.Add(-age).Format(time.RFC3339Nano),
+		}
+		if importance != "" {
+			metadata["importance"] = importance
+		}
+		return chromem.Result{ID: id, Metadata: metadata}
+	}
+
+	memories := []chromem.Result{
+		memory("chat_old", `{"type":"conversation"}`, 100*time.Hour, ""),
+		memory("chat_new", `{"type":"conversation"}`, time.Hour, ""),
+		memory("chat_pinned", `{"type":"conversation"}`, 100*time.Hour, "5"),
+		memory("chat_alias", `{"type":"chat"}`, 100*time.Hour, ""),
+		memory("scratch_old", `{"type":"scratch"}`, 2*time.Hour, "4"),
+		memory("fact_old", `{"type":"fact"}`, 10000*time.Hour, ""),
+		memory("untyped_old", "", 10000*time.Hour, ""),
+	}
+	policies := map[string]time.Duration{"conversation": 72 * time.Hour, "scratch": time.Hour}
+	canonical := func(t string) string {
+		if t == "chat" {
+			return "conversation"
+		}
+		return t
+	}
+
+	got := retentionCandidates(memories, policies, canonical, now)
+	want := map[string][]string{
+		"conversation": {"chat_alias", "chat_old"},
+		"scratch":      {"scratch_old"},
+	}
+	if !maps.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("retentionCandidates = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/philippgille/chromem-go"
+	"github.com/sashabaranov/go-openai"
+)
+
+// schemaVersion is bumped whenever the way memories are embedded changes in a
+// way that makes previously stored vectors incomparable with new ones.
+const schemaVersion = 1
+
+// storeSchema records how the stored embeddings were produced.
+type storeSchema struct {
+	Version        int    `json:"version"`
+	EmbeddingModel string `json:"embedding_model"`
+	// EmbeddingDimensions is the size of the stored vectors.
+	EmbeddingDimensions int `json:"embedding_dimensions"`
+	// EmbeddingURL is the embeddings endpoint, empty for OpenAI. Providers
+	// serving the same model name may still produce different vectors.
+	EmbeddingURL string `json:"embedding_url,omitempty"`
+	// EmbedsMetadata is set when metadata values are embedded along with
+	// the content.
+	EmbedsMetadata bool `json:"embeds_metadata,omitempty"`
+}
+
+// currentSchema describes how ms embeds memories.
+func (ms *MemoryServer) currentSchema() storeSchema {
+	return storeSchema{
+		Version:             schemaVersion,
+		EmbeddingModel:      string(embeddingModel),
+		EmbeddingDimensions: embeddingDimensions,
+		EmbeddingURL:        ms.embedURL,
+		EmbedsMetadata:      ms.embedMetadata,
+	}
+}
+
+// schemaDriftActions are what ensureSchema may do when the stored schema
+// differs from the current one: re-embed every memory, refuse to start, or
+// log a warning and serve the stale vectors anyway.
+var schemaDriftActions = []string{"reindex", "fail", "warn"}
+
+// ensureSchema compares the schema marker at path with the current schema and
+// acts on a difference as onDrift says. By default every stored memory is
+// re-embedded, so stale vectors never get compared against query embeddings
+// from a different model. A store without a marker predates it and was
+// embedded with the original model.
+func (ms *MemoryServer) ensureSchema(ctx context.Context, collection *chromem.Collection, path, onDrift string) error {
+	want := ms.currentSchema()
+
+	have, err := readSchema(path)
+	if err != nil {
+		return err
+	}
+
+	// Listing and re-embedding query the stored vectors with one of the new
+	// size, which only works while they are all the same size
+	if have.EmbeddingDimensions != want.EmbeddingDimensions && ms.storedMemories() > 0 {
+		return fmt.Errorf("stored memories have %d-dimensional embeddings but MEMORY_EMBED_DIMENSIONS is %d; "+
+			"export them with the old settings and import them into an empty store to re-embed", have.EmbeddingDimensions, want.EmbeddingDimensions)
+	}
+
+	if have != want {
+		switch onDrift {
+		case "fail":
+			return fmt.Errorf("store schema %+v doesn't match the current %+v; set MEMORY_SCHEMA_DRIFT=reindex to re-embed the %d stored memories", have, want, collection.Count())
+		case "warn":
+			// Leave the marker alone so the drift is reported again
+			log.Printf("WARNING: store schema %+v doesn't match the current %+v; search results may be wrong until memories are re-embedded", have, want)
+			return nil
+		}
+		log.Printf("Store schema changed (%+v -> %+v); re-embedding %d memories", have, want, collection.Count())
+		if err := ms.reembedAll(ctx, collection); err != nil {
+			return fmt.Errorf("failed to re-embed memories for new schema: %w", err)
+		}
+	}
+
+	data, err := json.Marshal(want)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// readSchema reads the schema marker at path.
+func readSchema(path string) (storeSchema, error) {
+	have := storeSchema{Version: 1, EmbeddingModel: string(openai.AdaEmbeddingV2), EmbeddingDimensions: 1536}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &have); err != nil {
+			return storeSchema{}, fmt.Errorf("corrupt schema marker %s: %w", path, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return storeSchema{}, fmt.Errorf("failed to read schema marker: %w", err)
+	}
+	return have, nil
+}
+
+// storedMemories counts the documents in every collection of the database,
+// including sealed memories.
+func (ms *MemoryServer) storedMemories() int {
+	n := 0
+	for _, collection := range ms.db.ListCollections() {
+		n += collection.Count()
+	}
+	return n
+}
+
+// reembedAll regenerates the embedding of every stored memory in place.
+func (ms *MemoryServer) reembedAll(ctx context.Context, collection *chromem.Collection) error {
+	memories, err := listMemories(ctx, collection)
+	if err != nil {
+		return err
+	}
+
+	_, err = ms.reembed(ctx, collection, memories)
+	return err
+}
+
+// reembed regenerates the embeddings of the given memories in place and
+// returns how many were updated before any error.
+func (ms *MemoryServer) reembed(ctx context.Context, collection *chromem.Collection, memories []chromem.Result) (int, error) {
+	for i, memory := range memories {
+		embedding, err := ms.embedMemory(ctx, memory.Content, memory.Metadata["raw_metadata"])
+		if err != nil {
+			return i, fmt.Errorf("failed to embed %s: %w", memory.ID, err)
+		}
+
+		err = collection.AddDocument(ctx, chromem.Document{
+			ID:        memory.ID,
+			Metadata:  memory.Metadata,
+			Embedding: embedding,
+			Content:   memory.Content,
+		})
+		if err != nil {
+			return i, fmt.Errorf("failed to update %s: %w", memory.ID, err)
+		}
+	}
+
+	return len(memories), nil
+}
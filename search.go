@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/philippgille/chromem-go"
+)
+
+// searchOptions are the parameters accepted by search_memory.
+type searchOptions struct {
+	Query            string
+	Limit            int
+	Offset           int
+	Dedupe           bool
+	MinImportance    int
+	MinMatch         int
+	SortByImportance bool
+	Sort             sortSpec
+	ExcludeQuery     string
+	CaseSensitive    bool
+	// MinSimilarity is the similarity a memory needs to match the query;
+	// zero admits every memory.
+	MinSimilarity float32
+	// KeywordFallback answers with a keyword scan when the query can't be
+	// embedded, instead of failing.
+	KeywordFallback bool
+	// ExpandSynonyms adds the synonyms of the query's words to the query
+	// before ranking; minMatch still counts the words as written.
+	ExpandSynonyms bool
+}
+
+// defaultMinSimilarity is the similarity a memory needs to match a query
+// whose matches aren't ordered by relevance, unless minSimilarity says
+// otherwise. Otherwise every memory would match, and e.g. ordering by
+// created_at would list the newest memories whatever the query.
+const defaultMinSimilarity = 0.7
+
+// sortFields are the fields search results can be ordered by.
+var sortFields = []string{"relevance", "created_at", "updated_at", "importance"}
+
+// sortSpec orders search results by a field.
+type sortSpec struct {
+	Field string
+	Desc  bool
+}
+
+// parseSortSpec parses "field" or "field:asc|desc". Timestamps and
+// importance default to descending, relevance is always most similar first.
+func parseSortSpec(spec string) (sortSpec, error) {
+	field, dir, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	if !slices.Contains(sortFields, field) {
+		return sortSpec{}, fmt.Errorf("invalid sort field %q; valid fields are %s", field, strings.Join(sortFields, ", "))
+	}
+
+	switch dir {
+	case "", "desc":
+		return sortSpec{Field: field, Desc: true}, nil
+	case "asc":
+		if field == "relevance" {
+			return sortSpec{}, errors.New("relevance can only be sorted descending")
+		}
+		return sortSpec{Field: field}, nil
+	default:
+		return sortSpec{}, fmt.Errorf("invalid sort direction %q; use asc or desc", dir)
+	}
+}
+
+// sortResults orders results by spec, keeping relevance order among ties.
+func sortResults(results []chromem.Result, spec sortSpec) {
+	key := func(r chromem.Result) float64 {
+		switch spec.Field {
+		case "created_at":
+			t, _ := memoryCreatedAt(r.ID, r.Metadata)
+			return float64(t.UnixNano())
+		case "updated_at":
+			return float64(memoryLastActive(r.ID, r.Metadata).UnixNano())
+		case "importance":
+			return float64(memoryImportance(r.Metadata))
+		}
+		return 0
+	}
+
+	if spec.Field == "relevance" || spec.Field == "" {
+		return
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if spec.Desc {
+			return key(results[i]) > key(results[j])
+		}
+		return key(results[i]) < key(results[j])
+	})
+}
+
+// searchArguments declares the search_memory parameters on a tool.
+func searchArguments() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("Search query to find similar memories"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of results (default: 5)"),
+			mcp.Min(1),
+			mcp.Max(20),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Skip this many matches, in the order they are returned, to page through large result sets (default: 0)"),
+			mcp.Min(0),
+		),
+		mcp.WithBoolean("dedupeResults",
+			mcp.Description("Collapse results with identical content, keeping the most similar (default: false)"),
+		),
+		mcp.WithNumber("minImportance",
+			mcp.Description("Only return memories with at least this importance"),
+			mcp.Min(minImportance),
+			mcp.Max(maxImportance),
+		),
+		mcp.WithBoolean("sortByImportance",
+			mcp.Description("Rank by importance first and similarity second (default: false)"),
+		),
+		mcp.WithNumber("minMatch",
+			mcp.Description("Only return memories containing at least this many distinct words of the query"),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("minSimilarity",
+			mcp.Description(fmt.Sprintf("Only return memories at least this similar to the query (default: none, or %.1f when ordering by anything but relevance)", defaultMinSimilarity)),
+			mcp.Min(0),
+			mcp.Max(1),
+		),
+		mcp.WithBoolean("chronological",
+			mcp.Description("Order all matches oldest first instead of by relevance, like sort created_at:asc (default: false)"),
+		),
+		mcp.WithString("sort",
+			mcp.Description("Order all matches by field:dir before paging, one of "+strings.Join(sortFields, ", ")+"; without a filter every memory matches (default: MEMORY_DEFAULT_SORT or relevance)"),
+		),
+		mcp.WithString("excludeQuery",
+			mcp.Description("Drop memories containing any word of this text, e.g. \"staging\""),
+		),
+		mcp.WithBoolean("expandSynonyms",
+			mcp.Description("Also search for synonyms of the query's words from MEMORY_QUERY_SYNONYMS, so \"car\" finds memories about automobiles (default: false)"),
+		),
+		mcp.WithBoolean("caseSensitive",
+			mcp.Description("Match words for minMatch and excludeQuery in their exact case, so \"Apple\" doesn't match \"apple\"; similarity ranking is unaffected (default: false)"),
+		),
+	}
+}
+
+// maxBatchQueries bounds the number of searches a batch_search call runs.
+const maxBatchQueries = 10
+
+// parseSearchOptions reads the search_memory parameters from tool arguments,
+// using defaultSort when the call doesn't ask for an order.
+func parseSearchOptions(arguments map[string]any, defaultSort sortSpec) (searchOptions, error) {
+	query, ok := arguments["query"].(string)
+	if !ok {
+		return searchOptions{}, errors.New("query must be a string")
+	}
+
+	opts := searchOptions{Query: query, Limit: 5}
+	if l, ok := arguments["limit"].(float64); ok {
+		opts.Limit = int(l)
+	}
+	if opts.Limit < 1 {
+		return searchOptions{}, errors.New("limit must be at least 1")
+	}
+	if o, ok := arguments["offset"].(float64); ok {
+		opts.Offset = int(o)
+	}
+	if opts.Offset < 0 {
+		return searchOptions{}, errors.New("offset must not be negative")
+	}
+	if m, ok := arguments["minImportance"].(float64); ok {
+		opts.MinImportance = int(m)
+	}
+	if m, ok := arguments["minMatch"].(float64); ok {
+		opts.MinMatch = int(m)
+	}
+	opts.Dedupe, _ = arguments["dedupeResults"].(bool)
+	opts.SortByImportance, _ = arguments["sortByImportance"].(bool)
+
+	opts.Sort = defaultSort
+	if spec, ok := arguments["sort"].(string); ok && spec != "" {
+		parsed, err := parseSortSpec(spec)
+		if err != nil {
+			return searchOptions{}, err
+		}
+		opts.Sort = parsed
+	} else if chronological, _ := arguments["chronological"].(bool); chronological {
+		opts.Sort = sortSpec{Field: "created_at"}
+	} else if opts.SortByImportance {
+		// An explicit importance ranking wins over the store-wide default
+		opts.Sort = sortSpec{}
+	}
+	opts.ExcludeQuery, _ = arguments["excludeQuery"].(string)
+	opts.CaseSensitive, _ = arguments["caseSensitive"].(bool)
+	opts.ExpandSynonyms, _ = arguments["expandSynonyms"].(bool)
+
+	if m, ok := arguments["minSimilarity"].(float64); ok {
+		opts.MinSimilarity = float32(m)
+	} else if opts.Sort.Field != "" && opts.Sort.Field != "relevance" {
+		opts.MinSimilarity = defaultMinSimilarity
+	}
+
+	return opts, nil
+}
+
+// searchResult is a page of search results.
+type searchResult struct {
+	Results []chromem.Result
+	// Offset is the number of matches skipped before Results.
+	Offset int
+	// Total is the number of memories that passed the similarity threshold
+	// and filters, of which Results holds at most Limit starting at Offset.
+	// A plain similarity search ranks every memory without selecting any,
+	// so it has no total and Total is -1.
+	Total int
+	// Suppressed counts the duplicates removed by Dedupe.
+	Suppressed int
+	// Degraded is set when results come from the keyword fallback rather
+	// than similarity search.
+	Degraded bool
+}
+
+// Counted reports whether Total holds the number of matches.
+func (r searchResult) Counted() bool {
+	return r.Total >= 0
+}
+
+// Truncated reports whether more memories matched after this page.
+func (r searchResult) Truncated() bool {
+	return r.Counted() && r.Offset+len(r.Results) < r.Total
+}
+
+// NextOffset is the offset of the page following this one.
+func (r searchResult) NextOffset() int {
+	return r.Offset + len(r.Results)
+}
+
+// search runs a search_memory query: it ranks memories by similarity,
+// applies the filters, orders the matches as opts.Sort says and trims them to
+// the page.
+func (ms *MemoryServer) search(ctx context.Context, collection *chromem.Collection, opts searchOptions, timeout time.Duration) (searchResult, error) {
+	// Duplicates, filters and re-ordering may push relevant memories past
+	// the limit, so consider everything and trim to the page afterwards.
+	nResults := opts.Offset + opts.Limit
+	selective := opts.Dedupe || opts.MinImportance > 0 || opts.MinMatch > 0 || opts.MinSimilarity > 0 || opts.ExcludeQuery != ""
+	reorder := opts.SortByImportance || (opts.Sort.Field != "" && opts.Sort.Field != "relevance")
+	scanAll := selective || reorder
+	if scanAll {
+		nResults = collection.Count()
+	}
+
+	query := opts.Query
+	if opts.ExpandSynonyms {
+		if ms.querySynonyms == nil {
+			return searchResult{}, errors.New("expandSynonyms requires MEMORY_QUERY_SYNONYMS to be set")
+		}
+		query = ms.querySynonyms.Expand(query)
+	}
+
+	res := searchResult{Offset: opts.Offset}
+	results, err := ms.searchMemories(ctx, collection, query, nResults, timeout)
+	if errors.Is(err, errQueryEmbedding) && opts.KeywordFallback {
+		log.Printf("Falling back to keyword search: %v", err)
+		results, err = keywordSearch(ctx, collection, query, opts.CaseSensitive)
+		res.Degraded = true
+	}
+	if err != nil {
+		return searchResult{}, err
+	}
+
+	// Keyword scores aren't similarities, so the threshold doesn't apply to
+	// them. Similarity results come most similar first.
+	if opts.MinSimilarity > 0 && !res.Degraded {
+		results = results[:sort.Search(len(results), func(i int) bool {
+			return results[i].Similarity < opts.MinSimilarity
+		})]
+	}
+
+	if opts.MinImportance > 0 || opts.MinMatch > 0 || opts.ExcludeQuery != "" {
+		filtered := results[:0]
+		for _, result := range results {
+			if memoryImportance(result.Metadata) < opts.MinImportance ||
+				matchedTerms(opts.Query, result.Content, opts.CaseSensitive) < opts.MinMatch ||
+				matchedTerms(opts.ExcludeQuery, result.Content, opts.CaseSensitive) > 0 {
+				continue
+			}
+			filtered = append(filtered, result)
+		}
+		results = filtered
+	}
+	if opts.SortByImportance {
+		sort.SliceStable(results, func(i, j int) bool {
+			return memoryImportance(results[i].Metadata) > memoryImportance(results[j].Metadata)
+		})
+	}
+
+	res.Total = -1
+	if selective || res.Degraded {
+		res.Total = len(results)
+	}
+	if opts.Dedupe {
+		results, res.Suppressed = dedupeResults(results)
+		res.Total = len(results)
+	}
+	// Order every match before paging, so e.g. the oldest matches come
+	// first rather than the most relevant ones in age order
+	sortResults(results, opts.Sort)
+	results = results[min(opts.Offset, len(results)):]
+	if len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+
+	res.Results = results
+	return res, nil
+}
+
+// errQueryEmbedding marks search failures caused by the embedding API rather
+// than the store.
+var errQueryEmbedding = errors.New("failed to generate query embedding")
+
+// searchMemories returns up to nResults memories ordered by similarity to
+// query. The embedding call and the scan together are bounded by timeout.
+func (ms *MemoryServer) searchMemories(ctx context.Context, collection *chromem.Collection, query string, nResults int, timeout time.Duration) ([]chromem.Result, error) {
+	if collection.Count() == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Generate query embedding
+	queryEmbedding, err := ms.generateEmbedding(ctx, query)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("search timed out after %s", timeout)
+		}
+		return nil, fmt.Errorf("%w: %w", errQueryEmbedding, err)
+	}
+
+	// Search for similar documents. Other tool calls may delete memories
+	// meanwhile, and the query fails if asked for more than are left, so
+	// count again and retry as listMemories does
+	var results []chromem.Result
+	for {
+		count := collection.Count()
+		if count == 0 {
+			return nil, nil
+		}
+		results, err = collection.QueryEmbedding(ctx, queryEmbedding, min(nResults, count), nil, nil)
+		if err == nil || collection.Count() >= count {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("search timed out after %s", timeout)
+		}
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	return results, nil
+}
+
+// keywordSearch ranks memories by the fraction of distinct query words they
+// contain, reported as their similarity. Words match ignoring case unless
+// caseSensitive is set, and memories containing none of them are left out.
+// It needs no embeddings, so it still works while the embedding API is
+// unavailable.
+func keywordSearch(ctx context.Context, collection *chromem.Collection, query string, caseSensitive bool) ([]chromem.Result, error) {
+	split := tokenize
+	if caseSensitive {
+		split = splitWords
+	}
+
+	terms := make(map[string]bool)
+	for _, term := range split(query) {
+		terms[term] = true
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	memories, err := listMemories(ctx, collection)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	var results []chromem.Result
+	for _, memory := range memories {
+		matched := matchedTerms(query, memory.Content, caseSensitive)
+		if matched == 0 {
+			continue
+		}
+		memory.Similarity = float32(matched) / float32(len(terms))
+		results = append(results, memory)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Similarity != results[j].Similarity {
+			return results[i].Similarity > results[j].Similarity
+		}
+		return results[i].ID < results[j].ID
+	})
+	return results, nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+)
+
+func TestParseSortSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    sortSpec
+		wantErr bool
+	}{
+		{spec: "relevance", want: sortSpec{Field: "relevance", Desc: true}},
+		{spec: "created_at", want: sortSpec{Field: "created_at", Desc: true}},
+		{spec: "created_at:asc", want: sortSpec{Field: "created_at"}},
+		{spec: " updated_at:desc ", want: sortSpec{Field: "updated_at", Desc: true}},
+		{spec: "importance:asc", want: sortSpec{Field: "importance"}},
+		{spec: "relevance:asc", wantErr: true},
+		{spec: "created_at:up", wantErr: true},
+		{spec: "content", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSortSpec(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSortSpec(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSortSpec(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	memory := func(id, createdAt, importance string) chromem.Result {
+		return chromem.Result{ID: id, Metadata: map[string]string{"created_at": createdAt, "importance": importance}}
+	}
+	// In relevance order
+	results := []chromem.Result{
+		memory("b", "2024-02-01T00:00:00Z", "5"),
+		memory("c", "2024-03-01T00:00:00Z", "1"),
+		memory("a", "2024-01-01T00:00:00Z", "5"),
+	}
+
+	tests := []struct {
+		spec sortSpec
+		want []string
+	}{
+		{spec: sortSpec{}, want: []string{"b", "c", "a"}},
+		{spec: sortSpec{Field: "relevance", Desc: true}, want: []string{"b", "c", "a"}},
+		{spec: sortSpec{Field: "created_at"}, want: []string{"a", "b", "c"}},
+		{spec: sortSpec{Field: "created_at", Desc: true}, want: []string{"c", "b", "a"}},
+		// Ties keep relevance order
+		{spec: sortSpec{Field: "importance", Desc: true}, want: []string{"b", "a", "c"}},
+	}
+
+	for _, tt := range tests {
+		sorted := slices.Clone(results)
+		sortResults(sorted, tt.spec)
+		var got []string
+		for _, r := range sorted {
+			got = append(got, r.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("sortResults(%+v) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+// addSearchFixture stores memories about cats, whose similarity to "cat"
+// decreases with age, and unrelated older ones.
+func addSearchFixture(t *testing.T) (*MemoryServer, *chromem.Collection) {
+	t.Helper()
+	ms, collection, _ := newTestServer(t)
+	day := func(d string) time.Time {
+		parsed, err := time.Parse(time.DateOnly, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	addTestMemory(t, ms, collection, "mem_cat", "cat", day("2024-03-01"))
+	addTestMemory(t, ms, collection, "mem_cat_food", "cat food", day("2024-02-01"))
+	addTestMemory(t, ms, collection, "mem_cat_mat", "the cat sat on a mat", day("2024-01-01"))
+	addTestMemory(t, ms, collection, "mem_stocks", "stock market report", day("2023-01-01"))
+	addTestMemory(t, ms, collection, "mem_weather", "rain expected tomorrow", day("2023-06-01"))
+	return ms, collection
+}
+
+func resultIDs(results []chromem.Result) []string {
+	ids := []string{}
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestSearchSortsBeforePaging(t *testing.T) {
+	ms, collection := addSearchFixture(t)
+	ctx := context.Background()
+
+	opts, err := parseSearchOptions(map[string]any{"query": "cat", "sort": "created_at:asc", "limit": 2.0, "minSimilarity": 0.3}, sortSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ms.search(ctx, collection, opts, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resultIDs(res.Results), []string{"mem_cat_mat", "mem_cat_food"}; !slices.Equal(got, want) {
+		t.Errorf("oldest matches first = %v, want %v", got, want)
+	}
+	if res.Total != 3 || !res.Truncated() {
+		t.Errorf("total %d, truncated %v; want 3 matches, truncated", res.Total, res.Truncated())
+	}
+
+	opts.Offset = res.NextOffset()
+	res, err = ms.search(ctx, collection, opts, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resultIDs(res.Results), []string{"mem_cat"}; !slices.Equal(got, want) {
+		t.Errorf("second page = %v, want %v", got, want)
+	}
+}
+
+func TestSearchChronological(t *testing.T) {
+	ms, collection := addSearchFixture(t)
+
+	opts, err := parseSearchOptions(map[string]any{"query": "cat", "chronological": true, "minSimilarity": 0.3}, sortSpec{Field: "importance", Desc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Sort != (sortSpec{Field: "created_at"}) {
+		t.Errorf("chronological gave order %+v, want created_at ascending", opts.Sort)
+	}
+
+	res, err := ms.search(context.Background(), collection, opts, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Ascending creation order, regardless of similarity
+	if got, want := resultIDs(res.Results), []string{"mem_cat_mat", "mem_cat_food", "mem_cat"}; !slices.Equal(got, want) {
+		t.Errorf("chronological results = %v, want %v", got, want)
+	}
+}
+
+func TestSearchDefaultSortThreshold(t *testing.T) {
+	defaultSort, err := parseSortSpec("created_at:desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := parseSearchOptions(map[string]any{"query": "cat"}, defaultSort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Sort != defaultSort || opts.MinSimilarity != defaultMinSimilarity {
+		t.Errorf("default sort gave %+v with threshold %v, want %+v with %v", opts.Sort, opts.MinSimilarity, defaultSort, defaultMinSimilarity)
+	}
+
+	opts, err = parseSearchOptions(map[string]any{"query": "cat", "sort": "relevance"}, defaultSort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.MinSimilarity != 0 {
+		t.Errorf("relevance order has threshold %v, want none", opts.MinSimilarity)
+	}
+
+	// The newest memory isn't about cats, so it must not come first
+	ms, collection := addSearchFixture(t)
+	addTestMemory(t, ms, collection, "mem_newest", "lunch with the team", time.Now())
+	opts, err = parseSearchOptions(map[string]any{"query": "cat"}, defaultSort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ms.search(context.Background(), collection, opts, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(resultIDs(res.Results), "mem_newest") {
+		t.Errorf("newest-first search for cat returned %v, including an unrelated memory", resultIDs(res.Results))
+	}
+}
+
+func TestSearchTotal(t *testing.T) {
+	ms, collection := addSearchFixture(t)
+
+	tests := []struct {
+		name          string
+		arguments     map[string]any
+		wantTotal     int
+		wantTruncated bool
+	}{
+		// Every memory ranks, but none is selected
+		{name: "plain", arguments: map[string]any{"limit": 2.0}, wantTotal: -1},
+		{name: "threshold", arguments: map[string]any{"limit": 2.0, "minSimilarity": 0.3}, wantTotal: 3, wantTruncated: true},
+		{name: "filter", arguments: map[string]any{"limit": 2.0, "minMatch": 1.0}, wantTotal: 3, wantTruncated: true},
+		{name: "all on page", arguments: map[string]any{"limit": 5.0, "minMatch": 1.0}, wantTotal: 3},
+	}
+
+	for _, tt := range tests {
+		tt.arguments["query"] = "cat"
+		opts, err := parseSearchOptions(tt.arguments, sortSpec{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := ms.search(context.Background(), collection, opts, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != tt.wantTotal || res.Truncated() != tt.wantTruncated {
+			t.Errorf("%s: total %d, truncated %v; want %d, %v", tt.name, res.Total, res.Truncated(), tt.wantTotal, tt.wantTruncated)
+		}
+	}
+}
+
+func TestSearchCountMatchesStored(t *testing.T) {
+	ms, collection := addSearchFixture(t)
+	ctx := context.Background()
+
+	// count_search asks for a single result and reads the total
+	opts, err := parseSearchOptions(map[string]any{"query": "cat", "limit": 1.0}, sortSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.MinSimilarity = defaultMinSimilarity
+	res, err := ms.search(ctx, collection, opts, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ranked, err := ms.searchMemories(ctx, collection, "cat", collection.Count(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 0
+	for _, r := range ranked {
+		if r.Similarity >= defaultMinSimilarity {
+			want++
+		}
+	}
+	if want == 0 || want == len(ranked) {
+		t.Fatalf("fixture has %d of %d memories above the threshold; want some on each side", want, len(ranked))
+	}
+	if res.Total != want {
+		t.Errorf("counted %d matches, want the %d stored memories above %.1f similarity", res.Total, want, defaultMinSimilarity)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// typeSynonyms maps alternative names of a memory type to its preferred
+// name, e.g. "js" to "javascript". A nil map has no synonyms.
+type typeSynonyms map[string]string
+
+// loadTypeSynonyms reads a JSON object mapping each preferred type to a list
+// of its synonyms, such as {"javascript": ["js", "ecmascript"]}. An empty
+// path means no synonyms.
+func loadTypeSynonyms(path string) (typeSynonyms, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var groups map[string][]string
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	synonyms := make(typeSynonyms)
+	for canonical, aliases := range groups {
+		for _, alias := range aliases {
+			if other, ok := synonyms[alias]; ok && other != canonical {
+				return nil, fmt.Errorf("%q is listed as a synonym of both %q and %q", alias, other, canonical)
+			}
+			if _, ok := groups[alias]; ok && alias != canonical {
+				return nil, fmt.Errorf("%q is a preferred type and can't also be a synonym of %q", alias, canonical)
+			}
+			synonyms[alias] = canonical
+		}
+	}
+	return synonyms, nil
+}
+
+// Canonical returns the preferred name for the type t.
+func (s typeSynonyms) Canonical(t string) string {
+	if canonical, ok := s[t]; ok {
+		return canonical
+	}
+	return t
+}
+
+// querySynonyms maps each word to the words search treats as equivalent to
+// it, e.g. "car" to "automobile". A nil map has no synonyms.
+type querySynonyms map[string][]string
+
+// loadQuerySynonyms reads a JSON object mapping words to lists of their
+// synonyms, such as {"car": ["automobile", "auto"]}. Synonymy is symmetric,
+// so "automobile" also expands to "car". Entries are single words, matched
+// ignoring case.
+// An empty path means no synonyms.
+func loadQuerySynonyms(path string) (querySynonyms, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var groups map[string][]string
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	synonyms := make(querySynonyms)
+	link := func(a, b string) {
+		if a != b && !slices.Contains(synonyms[a], b) {
+			synonyms[a] = append(synonyms[a], b)
+		}
+	}
+	for word, alternatives := range groups {
+		word = strings.ToLower(word)
+		for _, alternative := range alternatives {
+			alternative = strings.ToLower(alternative)
+			link(word, alternative)
+			link(alternative, word)
+		}
+	}
+	return synonyms, nil
+}
+
+// Expand appends the synonyms of the words in query that it doesn't already
+// contain, so matching any of them counts as matching the query.
+func (s querySynonyms) Expand(query string) string {
+	words := tokenize(query)
+	present := make(map[string]bool, len(words))
+	for _, word := range words {
+		present[word] = true
+	}
+
+	var extra []string
+	for _, word := range words {
+		for _, synonym := range s[word] {
+			if !present[synonym] {
+				present[synonym] = true
+				extra = append(extra, synonym)
+			}
+		}
+	}
+	if len(extra) == 0 {
+		return query
+	}
+	return query + " " + strings.Join(extra, " ")
+}